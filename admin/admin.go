@@ -0,0 +1,411 @@
+// Package admin serves a small localhost JSON API and web dashboard for
+// watching and steering the running bot. The bot itself implements Backend;
+// this package only does HTTP, auth, JSON and the live event stream.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//go:embed web/index.html
+var webFS embed.FS
+
+var (
+	// ErrUnknownChat is returned by a Backend when a chat key isn't one of its targets
+	ErrUnknownChat = errors.New("unknown chat")
+	// ErrUnknownDraft is returned by a Backend when a draft ID isn't pending
+	ErrUnknownDraft = errors.New("unknown draft")
+	// ErrUnknownAccount is returned by a Backend when an account ID isn't running
+	ErrUnknownAccount = errors.New("unknown account")
+)
+
+// Message is one turn of a chat transcript
+type Message struct {
+	Speaker string    `json:"speaker"`
+	Text    string    `json:"text"`
+	At      time.Time `json:"at"`
+}
+
+// Target describes one chat the bot is talking in
+type Target struct {
+	Account     string     `json:"account"` // ID of the account that talks here
+	Chat        string     `json:"chat"`
+	Name        string     `json:"name,omitempty"`
+	JID         string     `json:"jid"`
+	LID         string     `json:"lid,omitempty"`
+	Goal        string     `json:"goal"`
+	HistoryLen  int        `json:"history_len"`
+	PausedUntil *time.Time `json:"paused_until,omitempty"`
+	ReplyDue    *time.Time `json:"reply_due,omitempty"`
+	Mood        *Mood      `json:"mood,omitempty"`
+}
+
+// Mood is how the target seems lately, with a daily timeline
+type Mood struct {
+	Label    string    `json:"label"`    // stressed, upset, down, happy or neutral
+	Valence  float64   `json:"valence"`  // -1 to 1
+	Stress   float64   `json:"stress"`   // 0 to 1
+	Messages int       `json:"messages"` // Recent messages with an emotional tone
+	Days     []MoodDay `json:"days"`     // Last 7 days, oldest first; quiet days left out
+}
+
+// MoodDay is one day of a target's mood timeline
+type MoodDay struct {
+	Date     string  `json:"date"` // YYYY-MM-DD
+	Valence  float64 `json:"valence"`
+	Stress   float64 `json:"stress"`
+	Messages int     `json:"messages"`
+}
+
+// Draft is a generated reply waiting for an operator decision
+type Draft struct {
+	ID        string     `json:"id"`
+	Chat      string     `json:"chat"`
+	Text      string     `json:"text"`
+	Context   string     `json:"context,omitempty"` // What they said
+	CreatedAt time.Time  `json:"created_at"`
+	Deadline  *time.Time `json:"deadline,omitempty"` // When the timeout policy kicks in
+}
+
+// Account is one WhatsApp number the bot runs
+type Account struct {
+	ID         string `json:"id"` // Phone number, or "new-N" until linked
+	Persona    string `json:"persona"`
+	Target     string `json:"target"` // Phone number
+	Connected  bool   `json:"connected"`
+	LoggedIn   bool   `json:"logged_in"`
+	Connection string `json:"connection"` // online, offline, pairing, logged_out, replaced, banned
+}
+
+// NewAccount asks the bot to link another WhatsApp number
+type NewAccount struct {
+	Target  string `json:"target"`            // Who the account talks to
+	Persona string `json:"persona,omitempty"` // Persona file name in the bot's personas directory, empty for the built-in one
+	// PairPhone links with a pairing code sent to this number (the new
+	// account's own) instead of a QR code
+	PairPhone string `json:"pair_phone,omitempty"`
+}
+
+// Status is a snapshot of the bot. The top-level connection fields sum up
+// all accounts: connected only if every account is.
+type Status struct {
+	Connected        bool      `json:"connected"`
+	LoggedIn         bool      `json:"logged_in"`
+	Connection       string    `json:"connection"` // online, or the first account's state that isn't
+	Persona          string    `json:"persona"`
+	Accounts         []Account `json:"accounts"`
+	Targets          []Target  `json:"targets"`
+	ReviewReplies    bool      `json:"review_replies"`
+	LastLLMLatencyMs int64     `json:"last_llm_latency_ms"`
+}
+
+// Backend is what the bot exposes to the admin API
+type Backend interface {
+	Status() Status
+	History(chat string) ([]Message, error)
+	Send(ctx context.Context, chat, text string) error
+	Pause(chat string, d time.Duration) (time.Time, error)
+	Resume(chat string) error
+	SetGoal(chat, goal string) error
+	ClearHistory(chat string) error
+	Drafts() []Draft
+	// ApproveDraft sends a draft; a non-empty text replaces the generated one
+	ApproveDraft(ctx context.Context, id, text string) error
+	RejectDraft(id string) error
+	// AddAccount starts linking a new number; pairing shows up as QR or
+	// pairing code events
+	AddAccount(req NewAccount) (Account, error)
+	RemoveAccount(id string) error
+	// Calendar is the plans made in chats, as an iCalendar file
+	Calendar(ctx context.Context) ([]byte, error)
+}
+
+// Server is the admin HTTP server
+type Server struct {
+	backend Backend
+	hub     *Hub
+	token   string
+	srv     *http.Server
+}
+
+// NewServer builds an admin server on addr. Every API request must carry
+// "Authorization: Bearer <token>"; an empty token is refused. The dashboard
+// page itself is public and asks for the token in the browser.
+func NewServer(addr, token string, backend Backend, hub *Hub) (*Server, error) {
+	if token == "" {
+		return nil, errors.New("admin token is empty")
+	}
+	if hub == nil {
+		hub = NewHub()
+	}
+	s := &Server{backend: backend, hub: hub, token: token}
+
+	api := http.NewServeMux()
+	api.HandleFunc("GET /api/status", s.handleStatus)
+	api.HandleFunc("GET /api/chats/{chat}/history", s.handleHistory)
+	api.HandleFunc("POST /api/chats/{chat}/send", s.handleSend)
+	api.HandleFunc("POST /api/chats/{chat}/pause", s.handlePause)
+	api.HandleFunc("POST /api/chats/{chat}/resume", s.handleResume)
+	api.HandleFunc("POST /api/chats/{chat}/clear", s.handleClear)
+	api.HandleFunc("POST /api/chats/{chat}/goal", s.handleGoal)
+	api.HandleFunc("GET /api/drafts", s.handleDrafts)
+	api.HandleFunc("POST /api/drafts/{id}/approve", s.handleApprove)
+	api.HandleFunc("POST /api/drafts/{id}/reject", s.handleReject)
+	api.HandleFunc("POST /api/accounts", s.handleAddAccount)
+	api.HandleFunc("DELETE /api/accounts/{id}", s.handleRemoveAccount)
+	api.HandleFunc("GET /api/plans.ics", s.handleCalendar)
+	api.HandleFunc("GET /api/events", s.handleEvents)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", s.auth(api))
+	mux.HandleFunc("GET /{$}", s.handleIndex)
+
+	s.srv = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s, nil
+}
+
+// Start listens in the background. It fails fast if the address can't be bound.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return err
+	}
+	if host, _, _ := net.SplitHostPort(ln.Addr().String()); !net.ParseIP(host).IsLoopback() {
+		fmt.Printf("⚠️  Admin API is listening on non-loopback address %s\n", ln.Addr())
+	}
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("❌ Admin API stopped: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the server gracefully
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+func (s *Server) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		// EventSource can't set headers, so the event stream may pass the token in the URL
+		if !ok && r.URL.Path == "/api/events" {
+			got = r.URL.Query().Get("token")
+			ok = got != ""
+		}
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	page, err := webFS.ReadFile("web/index.html")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.backend.Status())
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	msgs, err := s.backend.History(r.PathValue("chat"))
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, msgs)
+}
+
+func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Text string `json:"text"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if strings.TrimSpace(body.Text) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("text is required"))
+		return
+	}
+	if err := s.backend.Send(r.Context(), r.PathValue("chat"), body.Text); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Duration string `json:"duration"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	d, err := time.ParseDuration(body.Duration)
+	if err != nil || d <= 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid duration %q", body.Duration))
+		return
+	}
+	until, err := s.backend.Pause(r.PathValue("chat"), d)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]time.Time{"paused_until": until})
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	if err := s.backend.Resume(r.PathValue("chat")); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "resumed"})
+}
+
+func (s *Server) handleClear(w http.ResponseWriter, r *http.Request) {
+	if err := s.backend.ClearHistory(r.PathValue("chat")); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "cleared"})
+}
+
+func (s *Server) handleGoal(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Goal string `json:"goal"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if strings.TrimSpace(body.Goal) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("goal is required"))
+		return
+	}
+	if err := s.backend.SetGoal(r.PathValue("chat"), body.Goal); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"goal": body.Goal})
+}
+
+func (s *Server) handleDrafts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.backend.Drafts())
+}
+
+func (s *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Text string `json:"text"`
+	}
+	if !readOptionalJSON(w, r, &body) {
+		return
+	}
+	if err := s.backend.ApproveDraft(r.Context(), r.PathValue("id"), strings.TrimSpace(body.Text)); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+}
+
+func (s *Server) handleReject(w http.ResponseWriter, r *http.Request) {
+	if err := s.backend.RejectDraft(r.PathValue("id")); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "rejected"})
+}
+
+func (s *Server) handleAddAccount(w http.ResponseWriter, r *http.Request) {
+	var body NewAccount
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if strings.TrimSpace(body.Target) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("target is required"))
+		return
+	}
+	account, err := s.backend.AddAccount(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, account)
+}
+
+func (s *Server) handleRemoveAccount(w http.ResponseWriter, r *http.Request) {
+	if err := s.backend.RemoveAccount(r.PathValue("id")); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "removed"})
+}
+
+func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
+	data, err := s.backend.Calendar(r.Context())
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="plans.ics"`)
+	w.Write(data)
+}
+
+// readOptionalJSON is readJSON for endpoints where the body may be omitted
+func readOptionalJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %v", err))
+		return false
+	}
+	return true
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeBackendError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrUnknownChat) || errors.Is(err, ErrUnknownDraft) || errors.Is(err, ErrUnknownAccount) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
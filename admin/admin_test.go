@@ -0,0 +1,286 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testToken = "s3cret"
+
+// fakeBackend records what the API asked for and fails with err if set
+type fakeBackend struct {
+	err   error
+	calls []string
+}
+
+func (b *fakeBackend) call(format string, args ...any) error {
+	b.calls = append(b.calls, fmt.Sprintf(format, args...))
+	return b.err
+}
+
+func (b *fakeBackend) Status() Status {
+	b.call("status")
+	return Status{Connected: true, Persona: "Leo", Targets: []Target{{Chat: "c1", Goal: "chat"}}}
+}
+
+func (b *fakeBackend) History(chat string) ([]Message, error) {
+	if err := b.call("history %s", chat); err != nil {
+		return nil, err
+	}
+	return []Message{{Speaker: "them", Text: "hey"}}, nil
+}
+
+func (b *fakeBackend) Send(_ context.Context, chat, text string) error {
+	return b.call("send %s %s", chat, text)
+}
+
+func (b *fakeBackend) Pause(chat string, d time.Duration) (time.Time, error) {
+	return time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC), b.call("pause %s %s", chat, d)
+}
+
+func (b *fakeBackend) Resume(chat string) error { return b.call("resume %s", chat) }
+
+func (b *fakeBackend) SetGoal(chat, goal string) error { return b.call("goal %s %s", chat, goal) }
+
+func (b *fakeBackend) ClearHistory(chat string) error { return b.call("clear %s", chat) }
+
+func (b *fakeBackend) Drafts() []Draft {
+	b.call("drafts")
+	return []Draft{{ID: "7", Chat: "c1", Text: "sure"}}
+}
+
+func (b *fakeBackend) ApproveDraft(_ context.Context, id, text string) error {
+	return b.call("approve %s %s", id, text)
+}
+
+func (b *fakeBackend) RejectDraft(id string) error { return b.call("reject %s", id) }
+
+func (b *fakeBackend) AddAccount(req NewAccount) (Account, error) {
+	if err := b.call("add %s %s", req.Target, req.Persona); err != nil {
+		return Account{}, err
+	}
+	return Account{ID: "new-1", Target: req.Target, Connection: "pairing"}, nil
+}
+
+func (b *fakeBackend) RemoveAccount(id string) error { return b.call("remove %s", id) }
+
+func (b *fakeBackend) Calendar(context.Context) ([]byte, error) {
+	return []byte("BEGIN:VCALENDAR\r\n"), b.call("calendar")
+}
+
+func newTestServer(t *testing.T, b Backend) *Server {
+	t.Helper()
+	s, err := NewServer("127.0.0.1:0", testToken, b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// do sends a request with the test token to s
+func do(s *Server, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestNewServerNeedsToken(t *testing.T) {
+	if _, err := NewServer("127.0.0.1:0", "", &fakeBackend{}, nil); err == nil {
+		t.Error("empty token: want an error")
+	}
+}
+
+func TestAuth(t *testing.T) {
+	b := &fakeBackend{}
+	s := newTestServer(t, b)
+	for name, set := range map[string]func(r *http.Request){
+		"no token":         func(r *http.Request) {},
+		"wrong token":      func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") },
+		"prefix of token":  func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3c") },
+		"not bearer":       func(r *http.Request) { r.Header.Set("Authorization", "Basic "+testToken) },
+		"bare token":       func(r *http.Request) { r.Header.Set("Authorization", testToken) },
+		"token in the URL": func(r *http.Request) { r.URL.RawQuery = "token=" + testToken },
+	} {
+		for _, route := range []string{"GET /api/status", "POST /api/chats/c1/send", "DELETE /api/accounts/a1", "GET /api/nope"} {
+			method, path, _ := strings.Cut(route, " ")
+			r := httptest.NewRequest(method, path, strings.NewReader(`{"text": "hi"}`))
+			set(r)
+			w := httptest.NewRecorder()
+			s.srv.Handler.ServeHTTP(w, r)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("%s, %s: got %d, want 401", name, route, w.Code)
+			}
+		}
+	}
+	if len(b.calls) > 0 {
+		t.Errorf("backend called without a valid token: %q", b.calls)
+	}
+
+	if w := do(s, "GET", "/api/status", ""); w.Code != http.StatusOK {
+		t.Errorf("valid token: got %d, want 200", w.Code)
+	}
+}
+
+func TestIndexIsPublic(t *testing.T) {
+	s := newTestServer(t, &fakeBackend{})
+	w := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("got %d %q, want the dashboard page", w.Code, w.Header().Get("Content-Type"))
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	for _, c := range []struct {
+		method, path, body string
+		status             int
+		call               string // What the backend should have been asked, "" for nothing
+		response           string // Expected in the response body
+	}{
+		{"GET", "/api/status", "", 200, "status", `"persona":"Leo"`},
+		{"GET", "/api/chats/c1/history", "", 200, "history c1", `"text":"hey"`},
+		{"POST", "/api/chats/c1/send", `{"text": "hi there"}`, 200, "send c1 hi there", `"sent"`},
+		{"POST", "/api/chats/c1/send", `{"text": "  "}`, 400, "", "text is required"},
+		{"POST", "/api/chats/c1/send", `{"text": `, 400, "", "invalid JSON"},
+		{"POST", "/api/chats/c1/send", "", 400, "", "invalid JSON"},
+		{"POST", "/api/chats/c1/pause", `{"duration": "90m"}`, 200, "pause c1 1h30m0s", `"paused_until":"2026-01-01T12:00:00Z"`},
+		{"POST", "/api/chats/c1/pause", `{"duration": "soon"}`, 400, "", "invalid duration"},
+		{"POST", "/api/chats/c1/pause", `{"duration": "-1h"}`, 400, "", "invalid duration"},
+		{"POST", "/api/chats/c1/resume", "", 200, "resume c1", `"resumed"`},
+		{"POST", "/api/chats/c1/clear", "", 200, "clear c1", `"cleared"`},
+		{"POST", "/api/chats/c1/goal", `{"goal": "plan dinner"}`, 200, "goal c1 plan dinner", `"goal":"plan dinner"`},
+		{"POST", "/api/chats/c1/goal", `{"goal": ""}`, 400, "", "goal is required"},
+		{"GET", "/api/drafts", "", 200, "drafts", `"id":"7"`},
+		{"POST", "/api/drafts/7/approve", "", 200, "approve 7 ", `"sent"`},
+		{"POST", "/api/drafts/7/approve", `{"text": " see you at 8 "}`, 200, "approve 7 see you at 8", `"sent"`},
+		{"POST", "/api/drafts/7/approve", `{"text": `, 400, "", "invalid JSON"},
+		{"POST", "/api/drafts/7/reject", "", 200, "reject 7", `"rejected"`},
+		{"POST", "/api/accounts", `{"target": "972521234567", "persona": "noa.json"}`, 202, "add 972521234567 noa.json", `"id":"new-1"`},
+		{"POST", "/api/accounts", `{"persona": "noa.json"}`, 400, "", "target is required"},
+		{"DELETE", "/api/accounts/972500000001", "", 200, "remove 972500000001", `"removed"`},
+		{"GET", "/api/plans.ics", "", 200, "calendar", "BEGIN:VCALENDAR"},
+	} {
+		b := &fakeBackend{}
+		w := do(newTestServer(t, b), c.method, c.path, c.body)
+		name := c.method + " " + c.path + " " + c.body
+		if w.Code != c.status {
+			t.Errorf("%s: got %d, want %d (%s)", name, w.Code, c.status, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), c.response) {
+			t.Errorf("%s: got %s, want it to contain %s", name, w.Body, c.response)
+		}
+		var want []string
+		if c.call != "" {
+			want = []string{c.call}
+		}
+		if fmt.Sprint(b.calls) != fmt.Sprint(want) {
+			t.Errorf("%s: backend got %q, want %q", name, b.calls, want)
+		}
+	}
+}
+
+func TestCalendarHeaders(t *testing.T) {
+	w := do(newTestServer(t, &fakeBackend{}), "GET", "/api/plans.ics", "")
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+		t.Errorf("content type %q, want text/calendar", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "plans.ics") {
+		t.Errorf("content disposition %q, want a plans.ics attachment", cd)
+	}
+}
+
+func TestMethods(t *testing.T) {
+	b := &fakeBackend{}
+	s := newTestServer(t, b)
+	for _, route := range []string{
+		"POST /api/status",
+		"DELETE /api/chats/c1/history",
+		"GET /api/chats/c1/send",
+		"GET /api/chats/c1/pause",
+		"GET /api/chats/c1/resume",
+		"PUT /api/chats/c1/clear",
+		"GET /api/chats/c1/goal",
+		"POST /api/drafts",
+		"GET /api/drafts/7/approve",
+		"DELETE /api/drafts/7/reject",
+		"GET /api/accounts",
+		"POST /api/accounts/a1",
+		"POST /api/plans.ics",
+		"POST /api/events",
+	} {
+		method, path, _ := strings.Cut(route, " ")
+		if w := do(s, method, path, "{}"); w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s: got %d, want 405", route, w.Code)
+		}
+	}
+	if w := do(s, "GET", "/api/nope", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown route: got %d, want 404", w.Code)
+	}
+	if len(b.calls) > 0 {
+		t.Errorf("backend called: %q", b.calls)
+	}
+}
+
+func TestBackendErrors(t *testing.T) {
+	for _, c := range []struct {
+		err    error
+		status int
+	}{
+		{ErrUnknownChat, http.StatusNotFound},
+		{ErrUnknownDraft, http.StatusNotFound},
+		{ErrUnknownAccount, http.StatusNotFound},
+		{fmt.Errorf("chat c9: %w", ErrUnknownChat), http.StatusNotFound},
+		{errors.New("database is locked"), http.StatusInternalServerError},
+	} {
+		for _, route := range []string{
+			"GET /api/chats/c1/history",
+			"POST /api/chats/c1/send",
+			"POST /api/chats/c1/pause",
+			"POST /api/chats/c1/resume",
+			"POST /api/chats/c1/clear",
+			"POST /api/chats/c1/goal",
+			"POST /api/drafts/7/approve",
+			"POST /api/drafts/7/reject",
+			"DELETE /api/accounts/a1",
+			"GET /api/plans.ics",
+		} {
+			method, path, _ := strings.Cut(route, " ")
+			w := do(newTestServer(t, &fakeBackend{err: c.err}), method, path, `{"text": "hi", "duration": "1h", "goal": "x"}`)
+			if w.Code != c.status {
+				t.Errorf("%s with %v: got %d, want %d", route, c.err, w.Code, c.status)
+			}
+			var body struct {
+				Error string `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error != c.err.Error() {
+				t.Errorf("%s with %v: got body %s, want the error", route, c.err, w.Body)
+			}
+		}
+	}
+
+	// A refused account is the request's fault, whatever the error
+	w := do(newTestServer(t, &fakeBackend{err: errors.New("persona not found")}), "POST", "/api/accounts", `{"target": "972521234567"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("add account: got %d, want 400", w.Code)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeError(w, http.StatusTeapot, errors.New("short and stout"))
+	if w.Code != http.StatusTeapot || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != `{"error":"short and stout"}` {
+		t.Errorf("got %s", got)
+	}
+}
@@ -0,0 +1,168 @@
+package admin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"rsc.io/qr"
+)
+
+// Event types pushed to dashboard subscribers
+const (
+	EventMessage       = "message"        // A turn was added to a transcript
+	EventBlocked       = "blocked"        // An incoming message was flagged as injection
+	EventEscalated     = "escalated"      // An incoming message paused the bot for a human to answer
+	EventFallback      = "fallback"       // The LLM broke character and a canned line was used
+	EventDraft         = "draft"          // A reply is waiting for approval
+	EventDraftResolved = "draft_resolved" // A draft was approved or rejected
+	EventQR            = "qr"             // A new pairing QR code is available for account ID
+	EventPairingCode   = "pairing_code"   // A phone-number pairing code is available for account ID (Text)
+	EventPaired        = "paired"         // Pairing of account ID finished, its code is no longer valid
+	EventConnection    = "connection"     // Connection state changed (Text is the new state)
+)
+
+// Event is one live update for the dashboard
+type Event struct {
+	Type    string    `json:"type"`
+	Chat    string    `json:"chat,omitempty"`
+	Speaker string    `json:"speaker,omitempty"`
+	Text    string    `json:"text,omitempty"`
+	ID      string    `json:"id,omitempty"`
+	Image   string    `json:"image,omitempty"` // data: URL (QR code PNG)
+	Time    time.Time `json:"time"`
+}
+
+// Hub fans events out to Server-Sent Events subscribers. Publishing never
+// blocks the bot: a subscriber that can't keep up misses events.
+type Hub struct {
+	mu      sync.Mutex
+	subs    map[chan Event]struct{}
+	pairing map[string]Event // Latest QR or pairing code per account, until ClearQR
+}
+
+// NewHub creates an empty hub
+func NewHub() *Hub {
+	return &Hub{subs: map[chan Event]struct{}{}, pairing: map[string]Event{}}
+}
+
+// Publish sends an event to every subscriber
+func (h *Hub) Publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.publish(e)
+}
+
+// publish is Publish for callers that hold h.mu
+func (h *Hub) publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// SetQR renders an account's pairing code to a PNG and publishes it. The
+// latest code is replayed to dashboards that connect later.
+func (h *Hub) SetQR(account, code string) error {
+	c, err := qr.Encode(code, qr.L)
+	if err != nil {
+		return fmt.Errorf("failed to render QR: %v", err)
+	}
+	e := Event{
+		Type:  EventQR,
+		ID:    account,
+		Image: "data:image/png;base64," + base64.StdEncoding.EncodeToString(c.PNG()),
+		Time:  time.Now(),
+	}
+	h.setPairing(e)
+	return nil
+}
+
+// SetPairingCode publishes a code for "Link with phone number instead". Like
+// QR codes, it is replayed to dashboards that connect later.
+func (h *Hub) SetPairingCode(account, code string) {
+	h.setPairing(Event{Type: EventPairingCode, ID: account, Text: code, Time: time.Now()})
+}
+
+// setPairing stores and publishes a code under one lock, so subscribers see
+// codes and ClearQR in the order they were stored
+func (h *Hub) setPairing(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pairing[e.ID] = e
+	h.publish(e)
+}
+
+// ClearQR drops an account's stored QR or pairing code and tells dashboards
+// its pairing is done
+func (h *Hub) ClearQR(account string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.pairing, account)
+	h.publish(Event{Type: EventPaired, ID: account})
+}
+
+func (h *Hub) subscribe() (chan Event, []Event) {
+	ch := make(chan Event, 64)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs[ch] = struct{}{}
+	pending := make([]Event, 0, len(h.pairing))
+	for _, e := range h.pairing {
+		pending = append(pending, e)
+	}
+	return ch, pending
+}
+
+func (h *Hub) unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, ch)
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming unsupported"))
+		return
+	}
+
+	ch, pending := s.hub.subscribe()
+	defer s.hub.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(e Event) {
+		data, _ := json.Marshal(e)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		flusher.Flush()
+	}
+	for _, e := range pending {
+		send(e)
+	}
+
+	keepAlive := time.NewTicker(20 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-ch:
+			send(e)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package admin
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// received drains what a subscriber has been sent so far
+func received(ch chan Event) []Event {
+	var got []Event
+	for {
+		select {
+		case e := <-ch:
+			got = append(got, e)
+		default:
+			return got
+		}
+	}
+}
+
+func TestPublishFanOut(t *testing.T) {
+	h := NewHub()
+	a, _ := h.subscribe()
+	b, _ := h.subscribe()
+	gone, _ := h.subscribe()
+	h.unsubscribe(gone)
+
+	h.Publish(Event{Type: EventMessage, Chat: "c1", Text: "hey"})
+	for name, ch := range map[string]chan Event{"a": a, "b": b} {
+		got := received(ch)
+		if len(got) != 1 || got[0].Text != "hey" || got[0].Time.IsZero() {
+			t.Errorf("%s: got %+v, want the event, timestamped", name, got)
+		}
+	}
+	if got := received(gone); len(got) != 0 {
+		t.Errorf("unsubscribed: got %+v", got)
+	}
+}
+
+func TestSlowSubscriberMissesEvents(t *testing.T) {
+	h := NewHub()
+	slow, _ := h.subscribe()
+	fast, _ := h.subscribe()
+
+	done := make(chan struct{})
+	var got []Event
+	go func() {
+		defer close(done)
+		for i := range 200 {
+			h.Publish(Event{Type: EventMessage, Text: string(rune('a' + i%26))})
+			got = append(got, <-fast)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish blocked on a subscriber that doesn't read")
+	}
+	if len(got) != 200 {
+		t.Errorf("reading subscriber got %d events, want all 200", len(got))
+	}
+	if n := len(received(slow)); n != cap(slow) {
+		t.Errorf("slow subscriber got %d events, want its buffer's %d", n, cap(slow))
+	}
+}
+
+func TestPairingReplay(t *testing.T) {
+	h := NewHub()
+	if err := h.SetQR("new-1", "2@abc,def,ghi"); err != nil {
+		t.Fatal(err)
+	}
+	h.SetPairingCode("new-2", "ABCD-1234")
+	h.SetPairingCode("new-1", "WXYZ-9876") // Replaces the QR code
+
+	ch, pending := h.subscribe()
+	byAccount := map[string]Event{}
+	for _, e := range pending {
+		byAccount[e.ID] = e
+	}
+	if len(pending) != 2 || byAccount["new-1"].Text != "WXYZ-9876" || byAccount["new-2"].Text != "ABCD-1234" {
+		t.Fatalf("replayed %+v, want the latest code of each account", pending)
+	}
+
+	h.ClearQR("new-1")
+	if got := received(ch); len(got) != 1 || got[0].Type != EventPaired || got[0].ID != "new-1" {
+		t.Errorf("got %+v, want new-1 paired", got)
+	}
+	_, pending = h.subscribe()
+	if len(pending) != 1 || pending[0].ID != "new-2" {
+		t.Errorf("after ClearQR, replayed %+v, want only new-2's code", pending)
+	}
+}
+
+func TestQRImage(t *testing.T) {
+	h := NewHub()
+	ch, _ := h.subscribe()
+	if err := h.SetQR("new-1", "2@abc,def,ghi"); err != nil {
+		t.Fatal(err)
+	}
+	got := received(ch)
+	if len(got) != 1 || got[0].Type != EventQR || got[0].ID != "new-1" || !strings.HasPrefix(got[0].Image, "data:image/png;base64,") {
+		t.Errorf("got %+v, want a PNG QR event for new-1", got)
+	}
+}
+
+// A subscriber's last pairing event for an account always matches what the
+// hub replays: a code that was cleared never arrives after "paired"
+func TestPairingOrder(t *testing.T) {
+	for range 200 {
+		h := NewHub()
+		ch, _ := h.subscribe()
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			h.SetPairingCode("new-1", "ABCD-1234")
+		}()
+		go func() {
+			defer wg.Done()
+			h.ClearQR("new-1")
+		}()
+		wg.Wait()
+
+		got := received(ch)
+		last := got[len(got)-1]
+		_, pending := h.subscribe()
+		if len(pending) == 0 && last.Type != EventPaired {
+			t.Fatalf("code cleared, but the last event was %+v", last)
+		}
+		if len(pending) == 1 && last.Type != EventPairingCode {
+			t.Fatalf("code still pending, but the last event was %+v", last)
+		}
+	}
+}
+
+func TestHandleEvents(t *testing.T) {
+	hub := NewHub()
+	hub.SetPairingCode("new-1", "ABCD-1234")
+	s, err := NewServer("127.0.0.1:0", testToken, &fakeBackend{}, hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s.srv.Handler)
+	defer srv.Close()
+
+	// EventSource can't send headers: the token may come in the URL
+	resp, err := http.Get(srv.URL + "/api/events?token=" + testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got %d %q, want an event stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func() (string, Event) {
+		t.Helper()
+		var typ string
+		for lines.Scan() {
+			line := lines.Text()
+			if v, ok := strings.CutPrefix(line, "event: "); ok {
+				typ = v
+			} else if v, ok := strings.CutPrefix(line, "data: "); ok {
+				var e Event
+				if err := json.Unmarshal([]byte(v), &e); err != nil {
+					t.Fatal(err)
+				}
+				return typ, e
+			}
+		}
+		t.Fatalf("stream ended: %v", lines.Err())
+		return "", Event{}
+	}
+
+	if typ, e := next(); typ != EventPairingCode || e.ID != "new-1" || e.Text != "ABCD-1234" {
+		t.Errorf("first event: got %s %+v, want the pending pairing code", typ, e)
+	}
+	// The stream is subscribed once the replay is written
+	hub.Publish(Event{Type: EventMessage, Chat: "c1", Speaker: "them", Text: "hey"})
+	if typ, e := next(); typ != EventMessage || e.Text != "hey" {
+		t.Errorf("got %s %+v, want the published message", typ, e)
+	}
+
+	for _, path := range []string{"/api/events", "/api/events?token=nope"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: got %d, want 401", path, resp.StatusCode)
+		}
+	}
+}
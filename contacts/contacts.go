@@ -0,0 +1,118 @@
+// Package contacts keeps the contacts the bot looks its targets up in, in the
+// bot's SQL database. They come from a contacts export
+// (whatsapp_contacts.json), imported at startup; LIDs learned while chatting
+// are saved back to the table, not to the export.
+package contacts
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"whatsapp-bot/migrate"
+)
+
+// ErrNotFound is returned by Lookup when no contact has the number
+var ErrNotFound = errors.New("contact not found")
+
+// Contact is one WhatsApp contact
+type Contact struct {
+	JID         string `json:"jid"` // The Phone Number ID (@s.whatsapp.net)
+	LID         string `json:"lid,omitempty"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	PhoneNumber string `json:"phone_number,omitempty"`
+}
+
+// export is the JSON format of a contacts export
+type export struct {
+	ExportedAt string             `json:"exported_at"`
+	Contacts   map[string]Contact `json:"contacts"`
+}
+
+// migrations of bot_contacts; append only
+var migrations = []migrate.Step{
+	{SQLite: `CREATE TABLE bot_contacts (
+	jid        TEXT PRIMARY KEY,
+	lid        TEXT NOT NULL DEFAULT '',
+	name       TEXT NOT NULL DEFAULT '',
+	type       TEXT NOT NULL DEFAULT '',
+	phone      TEXT NOT NULL DEFAULT '',
+	updated_at BIGINT NOT NULL
+)`},
+	{SQLite: `CREATE INDEX bot_contacts_phone ON bot_contacts (phone)`},
+}
+
+// Store keeps contacts by JID
+type Store struct {
+	db *sql.DB
+}
+
+// Open creates or upgrades the contacts table
+func Open(ctx context.Context, db *sql.DB, dialect migrate.Dialect) (*Store, error) {
+	if err := migrate.Apply(ctx, db, dialect, "contacts", migrations); err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+var nonDigits = regexp.MustCompile(`[^0-9]`)
+
+// Put adds or updates a contact. A known LID is kept when c has none.
+func (s *Store) Put(ctx context.Context, c Contact) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO bot_contacts (jid, lid, name, type, phone, updated_at) VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (jid) DO UPDATE SET
+			lid = CASE WHEN excluded.lid <> '' THEN excluded.lid ELSE bot_contacts.lid END,
+			name = excluded.name, type = excluded.type, phone = excluded.phone, updated_at = excluded.updated_at`,
+		c.JID, c.LID, c.Name, c.Type, nonDigits.ReplaceAllString(c.PhoneNumber, ""), time.Now().UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to store contact %s: %w", c.JID, err)
+	}
+	return nil
+}
+
+// Import reads a contacts export into the table and returns how many
+// contacts it had
+func (s *Store) Import(ctx context.Context, path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var e export
+	if err := json.Unmarshal(data, &e); err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	for jid, c := range e.Contacts {
+		if c.JID == "" {
+			c.JID = jid
+		}
+		if err := s.Put(ctx, c); err != nil {
+			return 0, err
+		}
+	}
+	return len(e.Contacts), nil
+}
+
+// Lookup finds a contact by phone number, in any format
+func (s *Store) Lookup(ctx context.Context, phone string) (Contact, error) {
+	var c Contact
+	err := s.db.QueryRowContext(ctx,
+		`SELECT jid, lid, name, type, phone FROM bot_contacts WHERE phone = $1 ORDER BY updated_at DESC LIMIT 1`,
+		nonDigits.ReplaceAllString(phone, "")).Scan(&c.JID, &c.LID, &c.Name, &c.Type, &c.PhoneNumber)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Contact{}, ErrNotFound
+	}
+	return c, err
+}
+
+// SetLID records the LID of a contact, adding the contact if it's unknown
+func (s *Store) SetLID(ctx context.Context, c Contact, lid string) error {
+	c.LID = lid
+	return s.Put(ctx, c)
+}
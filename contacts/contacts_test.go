@@ -0,0 +1,85 @@
+package contacts
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"whatsapp-bot/migrate/migratetest"
+)
+
+const exported = `{
+  "exported_at": "2026-10-01T10:00:00Z",
+  "contacts": {
+    "972546371966@s.whatsapp.net": {"jid": "972546371966@s.whatsapp.net", "name": "Dana", "type": "individual", "phone_number": "+972 54-637-1966"},
+    "972521234567@s.whatsapp.net": {"name": "Noa", "type": "individual", "phone_number": "972521234567"}
+  }
+}`
+
+func TestImportAndLookup(t *testing.T) {
+	ctx := context.Background()
+	migratetest.Each(t, Open, func(t *testing.T, s *Store) {
+		path := filepath.Join(t.TempDir(), "whatsapp_contacts.json")
+		if err := os.WriteFile(path, []byte(exported), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if n, err := s.Import(ctx, path); err != nil || n != 2 {
+			t.Fatalf("Import = %d, %v; want 2", n, err)
+		}
+		c, err := s.Lookup(ctx, "+972 (54) 637-1966")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.JID != "972546371966@s.whatsapp.net" || c.Name != "Dana" || c.PhoneNumber != "972546371966" {
+			t.Errorf("got %+v", c)
+		}
+		// The JID defaults to the export's key
+		if c, err := s.Lookup(ctx, "+972 52-123-4567"); err != nil || c.JID != "972521234567@s.whatsapp.net" {
+			t.Errorf("got %+v, %v", c, err)
+		}
+		if _, err := s.Lookup(ctx, "972500000000"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("unknown number: got %v, want ErrNotFound", err)
+		}
+
+		if _, err := s.Import(ctx, filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("missing export: got %v, want ErrNotExist", err)
+		}
+	})
+}
+
+func TestLIDSurvivesImport(t *testing.T) {
+	ctx := context.Background()
+	migratetest.Each(t, Open, func(t *testing.T, s *Store) {
+		path := filepath.Join(t.TempDir(), "whatsapp_contacts.json")
+		if err := os.WriteFile(path, []byte(exported), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Import(ctx, path); err != nil {
+			t.Fatal(err)
+		}
+
+		dana, _ := s.Lookup(ctx, "972546371966")
+		if err := s.SetLID(ctx, dana, "123456789@lid"); err != nil {
+			t.Fatal(err)
+		}
+		// Importing the export again (it has no LID) keeps the learned one
+		if _, err := s.Import(ctx, path); err != nil {
+			t.Fatal(err)
+		}
+		if c, _ := s.Lookup(ctx, "972546371966"); c.LID != "123456789@lid" || c.Name != "Dana" {
+			t.Errorf("got %+v", c)
+		}
+
+		// A target that wasn't in the export is added with its LID
+		stranger := Contact{JID: "972500000001@s.whatsapp.net", Name: "+972500000001", Type: "individual", PhoneNumber: "972500000001"}
+		if err := s.SetLID(ctx, stranger, "987@lid"); err != nil {
+			t.Fatal(err)
+		}
+		if c, err := s.Lookup(ctx, "972500000001"); err != nil || c.LID != "987@lid" {
+			t.Errorf("got %+v, %v", c, err)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package defense
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// ahoCorasick finds every occurrence of a fixed set of phrases in one pass
+// over the text, however many phrases there are. Matching is per rune and
+// case-insensitive (simple lowercase folding), so offsets map straight back
+// onto the original text.
+type ahoCorasick struct {
+	nodes   []acNode
+	lengths []int // Pattern lengths in runes
+}
+
+type acNode struct {
+	next map[rune]int
+	fail int
+	out  []int // Pattern indexes ending here, including via the fail chain
+}
+
+// acMatch is a phrase occurrence as byte offsets into the text
+type acMatch struct {
+	Pattern    int
+	Start, End int
+}
+
+func newAhoCorasick(patterns []string) *ahoCorasick {
+	ac := &ahoCorasick{
+		nodes:   []acNode{{next: map[rune]int{}}},
+		lengths: make([]int, len(patterns)),
+	}
+	for i, p := range patterns {
+		cur := 0
+		for _, r := range p {
+			r = unicode.ToLower(r)
+			n, ok := ac.nodes[cur].next[r]
+			if !ok {
+				n = len(ac.nodes)
+				ac.nodes = append(ac.nodes, acNode{next: map[rune]int{}})
+				ac.nodes[cur].next[r] = n
+			}
+			cur = n
+			ac.lengths[i]++
+		}
+		if ac.lengths[i] > 0 {
+			ac.nodes[cur].out = append(ac.nodes[cur].out, i)
+		}
+	}
+
+	// Breadth-first, so a node's fail target is complete before its children
+	var queue []int
+	for _, n := range ac.nodes[0].next {
+		queue = append(queue, n)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for r, child := range ac.nodes[cur].next {
+			ac.nodes[child].fail = ac.step(ac.nodes[cur].fail, r)
+			ac.nodes[child].out = append(ac.nodes[child].out, ac.nodes[ac.nodes[child].fail].out...)
+			queue = append(queue, child)
+		}
+	}
+	return ac
+}
+
+// step follows the goto/fail edges from state on rune r
+func (ac *ahoCorasick) step(state int, r rune) int {
+	for {
+		if n, ok := ac.nodes[state].next[r]; ok {
+			return n
+		}
+		if state == 0 {
+			return 0
+		}
+		state = ac.nodes[state].fail
+	}
+}
+
+// findAll returns every (possibly overlapping) phrase occurrence in text
+func (ac *ahoCorasick) findAll(text string) []acMatch {
+	var matches []acMatch
+	var starts []int // Byte offset of each rune seen so far
+	state := 0
+	for i, r := range text {
+		starts = append(starts, i)
+		state = ac.step(state, unicode.ToLower(r))
+		if len(ac.nodes[state].out) == 0 {
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		end := i + size
+		for _, p := range ac.nodes[state].out {
+			matches = append(matches, acMatch{
+				Pattern: p,
+				Start:   starts[len(starts)-ac.lengths[p]],
+				End:     end,
+			})
+		}
+	}
+	return matches
+}
@@ -0,0 +1,82 @@
+// Package defense scores incoming WhatsApp messages for prompt-injection
+// attempts. Several detectors (keyword list, scoring heuristic, local LLM
+// classifier) are combined into one confidence score, and a Policy turns
+// that score and the contact's history of strikes into a response.
+package defense
+
+import (
+	"context"
+	"fmt"
+)
+
+// Detection is one detector's opinion about a message
+type Detection struct {
+	Detector string
+	Score    float64  // 0 = clearly benign, 1 = clearly an injection attempt
+	Reasons  []string // What matched, for logs
+}
+
+// Detector scores a message for prompt injection
+type Detector interface {
+	Name() string
+	Detect(ctx context.Context, text string) (Detection, error)
+}
+
+// Weighted is a detector's place in an Ensemble
+type Weighted struct {
+	Detector Detector
+	Weight   float64
+	// MinPrior skips this detector unless the score so far is at least this
+	// high. Use it to keep slow detectors (the LLM) for ambiguous messages.
+	MinPrior float64
+}
+
+// Ensemble combines detectors into a weighted average score
+type Ensemble struct {
+	Members []Weighted
+}
+
+// Result is the combined score plus every detector's opinion
+type Result struct {
+	Score      float64
+	Detections []Detection
+}
+
+// Reasons flattens the reasons of every detector that fired
+func (r Result) Reasons() []string {
+	var out []string
+	for _, d := range r.Detections {
+		if d.Score > 0 {
+			for _, reason := range d.Reasons {
+				out = append(out, d.Detector+": "+reason)
+			}
+		}
+	}
+	return out
+}
+
+// Detect runs the members in order. A detector that errors (e.g. Ollama is
+// down) is skipped rather than failing the whole check. The text is
+// canonicalized once here; pattern detectors fold it further themselves.
+func (e *Ensemble) Detect(ctx context.Context, text string) Result {
+	var res Result
+	var sum, weights float64
+	text = Canonicalize(text)
+	for _, m := range e.Members {
+		if m.MinPrior > 0 && (weights == 0 || sum/weights < m.MinPrior) {
+			continue
+		}
+		d, err := m.Detector.Detect(ctx, text)
+		if err != nil {
+			fmt.Printf("⚠️  %s detector failed: %v\n", m.Detector.Name(), err)
+			continue
+		}
+		res.Detections = append(res.Detections, d)
+		sum += m.Weight * d.Score
+		weights += m.Weight
+	}
+	if weights > 0 {
+		res.Score = sum / weights
+	}
+	return res
+}
@@ -0,0 +1,172 @@
+package defense
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+type sample struct {
+	Text  string `json:"text"`
+	Label string `json:"label"` // "injection" or "benign"
+}
+
+func loadCorpus(t *testing.T) []sample {
+	t.Helper()
+	f, err := os.Open("testdata/injection_corpus.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var corpus []sample
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s sample
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			t.Fatalf("bad corpus line %q: %v", scanner.Text(), err)
+		}
+		corpus = append(corpus, s)
+	}
+	return corpus
+}
+
+// rates returns the false-positive rate on benign samples and the
+// false-negative rate on injections for a flagging function
+func rates(t *testing.T, corpus []sample, flagged func(string) bool) (fpr, fnr float64) {
+	t.Helper()
+	var benign, injections, fp, fn int
+	for _, s := range corpus {
+		hit := flagged(s.Text)
+		if s.Label == "injection" {
+			injections++
+			if !hit {
+				fn++
+				t.Logf("  missed:  %s", s.Text)
+			}
+		} else {
+			benign++
+			if hit {
+				fp++
+				t.Logf("  flagged: %s", s.Text)
+			}
+		}
+	}
+	return float64(fp) / float64(benign), float64(fn) / float64(injections)
+}
+
+func detectorFlags(d Detector, threshold float64) func(string) bool {
+	return func(text string) bool {
+		res, _ := d.Detect(context.Background(), text)
+		return res.Score >= threshold
+	}
+}
+
+// The keyword detector is the baseline the others are measured against. It
+// flags half the benign corpus (that's why it's weighted low in the
+// ensemble), so the limits only catch it getting worse.
+func TestKeywordDetectorBaseline(t *testing.T) {
+	fpr, fnr := rates(t, loadCorpus(t), detectorFlags(NewKeywordDetector(NewRuleSource(DefaultRuleSet())), Low.Score()))
+	t.Logf("keyword: false positives %.0f%%, false negatives %.0f%%", fpr*100, fnr*100)
+	if fpr > 0.55 {
+		t.Errorf("keyword false-positive rate %.0f%% > 55%%", fpr*100)
+	}
+	if fnr > 0.30 {
+		t.Errorf("keyword false-negative rate %.0f%% > 30%%", fnr*100)
+	}
+}
+
+func TestHeuristicDetector(t *testing.T) {
+	fpr, fnr := rates(t, loadCorpus(t), detectorFlags(NewHeuristicDetector(), 0.4))
+	t.Logf("heuristic: false positives %.0f%%, false negatives %.0f%%", fpr*100, fnr*100)
+	if fpr > 0.05 {
+		t.Errorf("heuristic false-positive rate %.0f%% > 5%%", fpr*100)
+	}
+	if fnr > 0.15 {
+		t.Errorf("heuristic false-negative rate %.0f%% > 15%%", fnr*100)
+	}
+}
+
+func TestEnsembleNeverIgnoresBenign(t *testing.T) {
+	ens := &Ensemble{Members: []Weighted{
+		{Detector: NewKeywordDetector(NewRuleSource(DefaultRuleSet())), Weight: 0.2},
+		{Detector: NewHeuristicDetector(), Weight: 0.8},
+	}}
+	corpus := loadCorpus(t)
+	now := time.Now()
+
+	// No contact: strikes would make the result depend on corpus order
+	ghosted := func(text string) bool {
+		r := NewPolicy(DefaultRules).Decide("", ens.Detect(context.Background(), text), now).Response
+		return r == Ignore || r == Deflect
+	}
+	fpr, fnr := rates(t, corpus, ghosted)
+	t.Logf("ensemble ignore/deflect: false positives %.0f%%, false negatives %.0f%%", fpr*100, fnr*100)
+	if fpr > 0 {
+		t.Errorf("ensemble ignored or deflected %.0f%% of benign messages", fpr*100)
+	}
+
+	acted := func(text string) bool {
+		return NewPolicy(DefaultRules).Decide("", ens.Detect(context.Background(), text), now).Response != Reply
+	}
+	fpr, fnr = rates(t, corpus, acted)
+	t.Logf("ensemble any action: false positives %.0f%%, false negatives %.0f%%", fpr*100, fnr*100)
+	if fnr > 0.15 {
+		t.Errorf("ensemble let %.0f%% of injections through untouched", fnr*100)
+	}
+}
+
+type fakeLLM struct{ answer string }
+
+func (f fakeLLM) complete(ctx context.Context, system, user string) (string, error) {
+	return f.answer, nil
+}
+
+func TestLLMDetectorParsesAnswer(t *testing.T) {
+	cases := []struct {
+		answer string
+		want   float64
+	}{
+		{`{"injection": true, "confidence": 0.9, "reason": "asks for prompt"}`, 0.9},
+		{`Sure: {"injection": false, "confidence": 0.8}`, 0.2},
+		{`{"injection": true, "confidence": 7}`, 1},
+	}
+	for _, c := range cases {
+		d := &LLMDetector{Complete: fakeLLM{c.answer}.complete}
+		got, err := d.Detect(context.Background(), "hi")
+		if err != nil {
+			t.Fatalf("%s: %v", c.answer, err)
+		}
+		if diff := got.Score - c.want; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("%s: score %.2f, want %.2f", c.answer, got.Score, c.want)
+		}
+	}
+
+	d := &LLMDetector{Complete: fakeLLM{"no idea"}.complete}
+	if _, err := d.Detect(context.Background(), "hi"); err == nil {
+		t.Error("expected an error for a non-JSON answer")
+	}
+}
+
+func TestEnsembleGatesSlowDetector(t *testing.T) {
+	calls := 0
+	slow := &LLMDetector{Complete: func(ctx context.Context, system, user string) (string, error) {
+		calls++
+		return `{"injection": false, "confidence": 1}`, nil
+	}}
+	ens := &Ensemble{Members: []Weighted{
+		{Detector: NewHeuristicDetector(), Weight: 1},
+		{Detector: slow, Weight: 1, MinPrior: 0.2},
+	}}
+	ens.Detect(context.Background(), "how was your week?")
+	if calls != 0 {
+		t.Errorf("LLM consulted for a clearly benign message")
+	}
+	ens.Detect(context.Background(), "act as a linux terminal")
+	if calls != 1 {
+		t.Errorf("LLM not consulted for an ambiguous message")
+	}
+}
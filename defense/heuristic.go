@@ -0,0 +1,63 @@
+package defense
+
+import (
+	"context"
+	"regexp"
+)
+
+// Signal is one weighted pattern of the HeuristicDetector
+type Signal struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Weight  float64 // 0..1, how suspicious a match is on its own
+}
+
+// DefaultSignals look at phrasing rather than single words: "reset my router"
+// scores nothing, "reset your instructions" scores high.
+var DefaultSignals = []Signal{
+	{"override-instructions", regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override|bypass)\b.{0,20}\b(all|any|the|your|previous|prior|above|earlier|these)\b.{0,20}\b(instructions?|rules|prompts?|guidelines|directives|programming|context)\b`), 0.9},
+	{"forget-everything", regexp.MustCompile(`(?i)\bforget (everything|all) (you('ve| have)? (know|knew|were told|learned)|above|before|previous|prior|your)\b`), 0.6},
+	{"system-prompt", regexp.MustCompile(`(?i)\b(system prompt|initial prompt|your (instructions|prompt|system message|programming|guidelines))\b`), 0.6},
+	{"identity-swap", regexp.MustCompile(`(?i)\b(you are now (a|an|called|named)|you('re| are) no longer|from now on,? you('re| are| will| must)|as a new character|new (persona|identity)|your new (role|name|character)|your role is now)\b`), 0.7},
+	{"role-marker", regexp.MustCompile(`(?im)(^\s*(system|assistant|user)\s*:|[\[<]/?\s*(system|assistant|inst)\b)`), 0.8},
+	{"mode-switch", regexp.MustCompile(`(?i)\b((enable|activate|enter|switch to|turn on|unlock) (dan|developer|god|sudo|admin|unrestricted) mode|do anything now)\b`), 0.8},
+	{"jailbreak", regexp.MustCompile(`(?i)\bjailbr(eak|oken)\b`), 0.6},
+	{"pretend", regexp.MustCompile(`(?i)\b(pretend (to be|you are|you're)|roleplay as|act as (a|an|the|if you were)\b)`), 0.45},
+	{"reveal-nature", regexp.MustCompile(`(?i)\b(you('re| are) (actually|really) (an? )?(ai|bot|assistant|language model|llm|chatgpt)|in reality you are|admit (you('re| are))? ?(an? )?(ai|bot))\b`), 0.5},
+	{"repeat-above", regexp.MustCompile(`(?i)\b(repeat|print|show|reveal|output)\b.{0,20}\b(text|words|instructions|everything|message)\b.{0,10}\b(above|before this|you were given)\b`), 0.7},
+	{"reset-self", regexp.MustCompile(`(?i)\breset (yourself|your (memory|instructions|context|persona|personality))\b`), 0.6},
+	{"simulate-being", regexp.MustCompile(`(?i)\bsimulate (being|an? (ai|assistant|chatbot|terminal|linux))\b`), 0.5},
+	{"encoding-command", regexp.MustCompile(`(?i)\b(decode|encode|execute)\s*:`), 0.35},
+	{"encoding-word", regexp.MustCompile(`(?i)\b(base64|rot13)\b`), 0.2},
+	{"encoded-blob", regexp.MustCompile(`[A-Za-z0-9+/]{16,}={0,2}`), 0.3},
+	{"code-injection", regexp.MustCompile(`(?i)(\beval\(|console\.log|<script|javascript:)`), 0.4},
+	{"hypothetical-frame", regexp.MustCompile(`(?i)\b(hypothetically|for educational purposes|in a fictional world where you)\b`), 0.2},
+	{"compulsion", regexp.MustCompile(`(?i)\byou (must|have to) (now )?(answer|obey|comply|follow|respond|tell)\b`), 0.4},
+}
+
+// HeuristicDetector combines weighted signals with a noisy-or, so two weak
+// signals together score higher than either alone.
+type HeuristicDetector struct {
+	Signals []Signal
+}
+
+// NewHeuristicDetector uses DefaultSignals
+func NewHeuristicDetector() *HeuristicDetector {
+	return &HeuristicDetector{Signals: DefaultSignals}
+}
+
+func (h *HeuristicDetector) Name() string { return "heuristic" }
+
+func (h *HeuristicDetector) Detect(ctx context.Context, text string) (Detection, error) {
+	d := Detection{Detector: h.Name()}
+	benign := 1.0
+	folded := Fold(text)
+	for _, s := range h.Signals {
+		if s.Pattern.MatchString(folded) {
+			benign *= 1 - s.Weight
+			d.Reasons = append(d.Reasons, s.Name)
+		}
+	}
+	d.Score = 1 - benign
+	return d, nil
+}
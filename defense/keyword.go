@@ -0,0 +1,39 @@
+package defense
+
+import "context"
+
+type languagesKey struct{}
+
+// WithLanguages tells detectors which languages a message is in, so
+// language-specific rules apply. Without it every rule applies.
+func WithLanguages(ctx context.Context, langs ...string) context.Context {
+	return context.WithValue(ctx, languagesKey{}, langs)
+}
+
+// Languages returns the languages set by WithLanguages
+func Languages(ctx context.Context) []string {
+	langs, _ := ctx.Value(languagesKey{}).([]string)
+	return langs
+}
+
+// KeywordDetector scores a message by the detect rules of the filter rule
+// file: the most severe phrase or regex found wins. It is cheap and catches
+// the obvious attempts, but words like "reset" or "simulate" also show up in
+// innocent messages, so give it a low weight in an Ensemble.
+type KeywordDetector struct {
+	Rules *RuleSource
+}
+
+// NewKeywordDetector shares rules with the text filter, so a hot-reloaded
+// rule file changes both at once
+func NewKeywordDetector(rules *RuleSource) *KeywordDetector {
+	return &KeywordDetector{Rules: rules}
+}
+
+func (k *KeywordDetector) Name() string { return "keyword" }
+
+func (k *KeywordDetector) Detect(ctx context.Context, text string) (Detection, error) {
+	d := Detection{Detector: k.Name()}
+	d.Score, d.Reasons = k.Rules.Rules().Score(Fold(text), Languages(ctx)...)
+	return d, nil
+}
@@ -0,0 +1,316 @@
+package defense
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization happens in two steps, for detection and the filter rules:
+// the persona and the history get the message as it was written, unless
+// the filter strips something from its canonical form.
+//
+//	Canonicalize: visual-order, invisible-free, NFKC, homoglyphs folded to
+//	              Latin inside mixed-script words. Case, spacing and real
+//	              Cyrillic, Greek or Hebrew kept. This is what the
+//	              detectors get.
+//	Fold:         Canonicalize + spaced-out words joined, whitespace
+//	              collapsed, lowercase, diacritics and niqqud removed,
+//	              leetspeak undone. Used for pattern matching.
+
+// invisible characters that hide inside words: zero-width joiners/spaces,
+// word joiner, invisible operators, BOM, soft hyphen, Mongolian vowel
+// separator, Hangul fillers
+var invisible = map[rune]bool{
+	'\u00AD': true, '\u034F': true, '\u061C': true, '\u115F': true, '\u1160': true,
+	'\u17B4': true, '\u17B5': true, '\u180E': true, '\u200B': true, '\u200C': true,
+	'\u200D': true, '\u2060': true, '\u2061': true, '\u2062': true, '\u2063': true,
+	'\u2064': true, '\u3164': true, '\uFEFF': true, '\uFFA0': true,
+}
+
+// Bidirectional controls. RLO flips the visual order of what follows, which
+// lets "snoitcurtsni erongi" display as "ignore instructions".
+const (
+	lre = '\u202A'
+	rle = '\u202B'
+	pdf = '\u202C'
+	lro = '\u202D'
+	rlo = '\u202E'
+	lri = '\u2066'
+	rli = '\u2067'
+	fsi = '\u2068'
+	pdi = '\u2069'
+	lrm = '\u200E'
+	rlm = '\u200F'
+)
+
+func isBidiControl(r rune) bool {
+	switch r {
+	case lre, rle, pdf, lro, rlo, lri, rli, fsi, pdi, lrm, rlm:
+		return true
+	}
+	return false
+}
+
+// confusables maps lookalike letters that NFKC leaves alone (Cyrillic,
+// Greek, IPA, Armenian...) to the Latin letter they imitate. Hebrew is
+// deliberately absent. Non-Latin ones are only folded where they pose as
+// Latin (see foldConfusables).
+var confusables = map[rune]rune{
+	// Cyrillic lowercase
+	'а': 'a', 'в': 'b', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'ё': 'e', 'һ': 'h', 'і': 'i', 'ї': 'i',
+	'ј': 'j', 'к': 'k', 'ӏ': 'l', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'г': 'r',
+	'ѕ': 's', 'т': 't', 'ц': 'u', 'ѵ': 'v', 'ԝ': 'w', 'х': 'x', 'у': 'y', 'з': '3',
+	// Cyrillic uppercase
+	'А': 'A', 'В': 'B', 'С': 'C', 'Е': 'E', 'Ё': 'E', 'Н': 'H', 'І': 'I', 'Ї': 'I', 'Ј': 'J',
+	'К': 'K', 'М': 'M', 'О': 'O', 'Р': 'P', 'Ѕ': 'S', 'Т': 'T', 'Х': 'X', 'У': 'Y', 'Ԛ': 'Q',
+	'Ԝ': 'W',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x', 'γ': 'y', 'ω': 'w', 'ϲ': 'c', 'ϳ': 'j',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M', 'Ν': 'N',
+	'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+	// Latin lookalikes and IPA
+	'ı': 'i', 'ȷ': 'j', 'ɑ': 'a', 'ɡ': 'g', 'ɩ': 'i', 'ɪ': 'i', 'ʏ': 'y', 'ᴀ': 'a', 'ᴄ': 'c',
+	'ᴅ': 'd', 'ᴇ': 'e', 'ᴊ': 'j', 'ᴋ': 'k', 'ᴍ': 'm', 'ᴏ': 'o', 'ᴘ': 'p', 'ᴛ': 't', 'ᴜ': 'u',
+	'ᴠ': 'v', 'ᴡ': 'w', 'ᴢ': 'z', 'ʀ': 'r', 'ɴ': 'n', 'ʟ': 'l', 'ʜ': 'h', 'ꜱ': 's', 'ɢ': 'g', 'ʙ': 'b', 'ꜰ': 'f',
+	// Armenian / Cherokee
+	'օ': 'o', 'ս': 'u', 'հ': 'h', 'ո': 'n', 'Ꭺ': 'A', 'Ꭼ': 'E', 'Ꮋ': 'H', 'Ꭵ': 'i', 'Ꮪ': 'S',
+	'Ꭲ': 'T',
+}
+
+// leet undoes digit/symbol substitutions inside words ("1gn0re" → "ignore")
+var leet = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's', '!': 'i', '|': 'l',
+}
+
+// Canonicalize returns the readable normalized form of a message
+func Canonicalize(text string) string {
+	text = visualOrder(text)
+
+	var b strings.Builder
+	for _, r := range norm.NFKC.String(text) {
+		if invisible[r] || isBidiControl(r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return foldConfusables(b.String())
+}
+
+// Fold returns the matching form of a message
+func Fold(text string) string {
+	text = collapseWhitespace(joinSpacedLetters(Canonicalize(text)))
+
+	// Decompose so accents and niqqud become separate marks, then drop them
+	var b strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(text)) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return unleet(norm.NFC.String(b.String()))
+}
+
+// foldConfusables maps lookalikes to Latin where they pose as Latin: in a
+// word that mixes them with other scripts ("іgnоrе" with a Cyrillic і and
+// о), or anywhere in a message whose only non-Latin letters are lookalikes.
+// Real Cyrillic or Greek ("привет, как дела") is left alone. Latin-script
+// lookalikes (small caps, IPA) are always folded.
+func foldConfusables(text string) string {
+	// Any Cyrillic, Greek... letter that imitates nothing means the message
+	// is really written in that script
+	genuine := false
+	for _, r := range text {
+		if _, ok := confusables[r]; !ok && unicode.IsLetter(r) && !unicode.Is(unicode.Latin, r) && !unicode.Is(unicode.Hebrew, r) {
+			genuine = true
+			break
+		}
+	}
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) {
+			i++
+			continue
+		}
+		j := i
+		latin, foreign := false, false
+		for ; j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.Is(unicode.Mn, runes[j])); j++ {
+			switch r := runes[j]; {
+			case unicode.Is(unicode.Latin, r):
+				latin = true
+			case unicode.IsLetter(r):
+				foreign = true
+			}
+		}
+		fold := (latin && foreign) || !genuine
+		for k := i; k < j; k++ {
+			if c, ok := confusables[runes[k]]; ok && (fold || unicode.Is(unicode.Latin, runes[k])) {
+				runes[k] = c
+			}
+		}
+		i = j
+	}
+	return string(runes)
+}
+
+// visualOrder reverses RLO spans (up to PDF or end of line), so the text
+// reads the way it is displayed
+func visualOrder(text string) string {
+	if !strings.ContainsRune(text, rlo) {
+		return text
+	}
+	var out []rune
+	var span []rune
+	inRLO := false
+	flush := func() {
+		for i := len(span) - 1; i >= 0; i-- {
+			out = append(out, span[i])
+		}
+		span = span[:0]
+	}
+	for _, r := range text {
+		switch {
+		case r == rlo:
+			inRLO = true
+		case inRLO && (r == pdf || r == '\n'):
+			flush()
+			inRLO = false
+			if r == '\n' {
+				out = append(out, r)
+			}
+		case inRLO:
+			span = append(span, r)
+		default:
+			out = append(out, r)
+		}
+	}
+	flush()
+	return string(out)
+}
+
+// collapseWhitespace turns any run of spaces/tabs (including exotic Unicode
+// spaces) into one space and runs of line breaks into one newline. Line
+// breaks are kept because "SYSTEM:" at the start of a line means something.
+func collapseWhitespace(text string) string {
+	var b strings.Builder
+	pendingSpace, pendingNewline := false, false
+	for _, r := range text {
+		switch {
+		case r == '\n' || r == '\r' || r == '\u2028' || r == '\u2029':
+			pendingNewline = true
+		case unicode.IsSpace(r):
+			pendingSpace = true
+		default:
+			if b.Len() > 0 {
+				if pendingNewline {
+					b.WriteByte('\n')
+				} else if pendingSpace {
+					b.WriteByte(' ')
+				}
+			}
+			pendingSpace, pendingNewline = false, false
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// joinSpacedLetters joins three or more single letters separated by single
+// spaces, dots, dashes or underscores: "i g n o r e" and "i.g.n.o.r.e" both
+// become "ignore". Multiple spaces between groups separate words.
+func joinSpacedLetters(text string) string {
+	runes := []rune(text)
+	var out []rune
+	for i := 0; i < len(runes); {
+		if !startsSpacedRun(runes, i) {
+			out = append(out, runes[i])
+			i++
+			continue
+		}
+		// Collect letter, sep, letter, sep, ... while the pattern holds
+		j := i
+		var word []rune
+		for j < len(runes) && unicode.IsLetter(runes[j]) && (j+1 == len(runes) || !unicode.IsLetter(runes[j+1])) {
+			word = append(word, runes[j])
+			if j+2 < len(runes) && isLetterSeparator(runes[j+1]) && unicode.IsLetter(runes[j+2]) &&
+				(j+3 == len(runes) || !unicode.IsLetter(runes[j+3])) {
+				j += 2
+				continue
+			}
+			j++
+			break
+		}
+		out = append(out, word...)
+		i = j
+	}
+	return string(out)
+}
+
+// startsSpacedRun reports whether a run of at least three spaced single
+// letters starts at i
+func startsSpacedRun(runes []rune, i int) bool {
+	if i > 0 && unicode.IsLetter(runes[i-1]) {
+		return false
+	}
+	count := 0
+	for j := i; j < len(runes); j += 2 {
+		if !unicode.IsLetter(runes[j]) || (j+1 < len(runes) && unicode.IsLetter(runes[j+1])) {
+			break
+		}
+		count++
+		if j+1 >= len(runes) || !isLetterSeparator(runes[j+1]) {
+			break
+		}
+	}
+	return count >= 3
+}
+
+func isLetterSeparator(r rune) bool {
+	return r == ' ' || r == '.' || r == '-' || r == '_' || r == '*'
+}
+
+// unleet maps digits/symbols back to letters, but only inside tokens that
+// also contain letters, so "at 5" and "10 min" keep their numbers
+func unleet(text string) string {
+	fields := strings.FieldsFunc(text, unicode.IsSpace)
+	if len(fields) == 0 {
+		return text
+	}
+	var b strings.Builder
+	rest := text
+	for _, f := range fields {
+		idx := strings.Index(rest, f)
+		b.WriteString(rest[:idx])
+		rest = rest[idx+len(f):]
+
+		hasLetter, hasLeet := false, false
+		for _, r := range f {
+			if unicode.IsLetter(r) {
+				hasLetter = true
+			} else if _, ok := leet[r]; ok {
+				hasLeet = true
+			}
+		}
+		if !hasLetter || !hasLeet {
+			b.WriteString(f)
+			continue
+		}
+		for i, r := range f {
+			// Leading/trailing "!" is punctuation, not an "i"
+			if (r == '!' || r == '$') && (i == 0 || i == len(f)-1) {
+				b.WriteRune(r)
+				continue
+			}
+			if l, ok := leet[r]; ok {
+				r = l
+			}
+			b.WriteRune(r)
+		}
+	}
+	b.WriteString(rest)
+	return b.String()
+}
@@ -0,0 +1,188 @@
+package defense
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Response is how the bot treats a suspicious message
+type Response string
+
+const (
+	Reply   Response = "reply"   // Normal message
+	Quote   Response = "quote"   // Reply normally, with the raw text quoted as user data
+	Deflect Response = "deflect" // Persona brushes it off without engaging
+	Ignore  Response = "ignore"  // No history, no reply
+)
+
+// Rule applies a response from a minimum score up
+type Rule struct {
+	MinScore float64
+	Response Response
+	Notify   bool // Also warn the owner
+}
+
+// DefaultRules keep real friends talking: only confident detections are
+// ignored, the grey zone gets a quoted or deflecting reply.
+var DefaultRules = []Rule{
+	{MinScore: 0.8, Response: Ignore, Notify: true},
+	{MinScore: 0.6, Response: Deflect, Notify: true},
+	{MinScore: 0.35, Response: Quote},
+}
+
+// ParseRules reads a rule list like "0.8:ignore+notify,0.6:deflect,0.35:quote"
+func ParseRules(spec string) ([]Rule, error) {
+	var rules []Rule
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		scoreStr, action, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("rule %q: want <score>:<response>[+notify]", part)
+		}
+		score, err := strconv.ParseFloat(strings.TrimSpace(scoreStr), 64)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %v", part, err)
+		}
+		rule := Rule{MinScore: score}
+		for _, word := range strings.Split(action, "+") {
+			switch r := Response(strings.ToLower(strings.TrimSpace(word))); r {
+			case Reply, Quote, Deflect, Ignore:
+				rule.Response = r
+			case "notify":
+				rule.Notify = true
+			default:
+				return nil, fmt.Errorf("rule %q: unknown response %q", part, word)
+			}
+		}
+		if rule.Response == "" {
+			rule.Response = Reply
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Verdict is the decision for one message
+type Verdict struct {
+	Score     float64 // What the detectors said
+	Effective float64 // Score after the contact's strikes are taken into account
+	Strikes   float64
+	Response  Response
+	Notify    bool
+	Reasons   []string
+}
+
+// Summary is a one-line description for logs and owner warnings
+func (v Verdict) Summary() string {
+	reasons := strings.Join(v.Reasons, "; ")
+	if reasons == "" {
+		reasons = "no signals"
+	}
+	return fmt.Sprintf("score %.2f (effective %.2f, %.1f strikes) → %s (%s)",
+		v.Score, v.Effective, v.Strikes, v.Response, reasons)
+}
+
+// Policy maps scores to responses. Contacts who keep sending suspicious
+// messages collect strikes that raise the effective score of their next
+// suspicious message; strikes decay with a half-life so an old joke is
+// eventually forgiven.
+type Policy struct {
+	Rules        []Rule
+	StrikeAt     float64       // Base score that counts as a strike
+	StrikeWeight float64       // Added to the effective score per strike
+	MinBoosted   float64       // Scores below this are never boosted (plain "hi" stays plain)
+	HalfLife     time.Duration // Strike decay
+
+	mu      sync.Mutex
+	strikes map[string]strikeCount
+}
+
+type strikeCount struct {
+	value float64
+	at    time.Time
+}
+
+// NewPolicy builds a policy with the default strike settings
+func NewPolicy(rules []Rule) *Policy {
+	p := &Policy{
+		StrikeAt:     0.5,
+		StrikeWeight: 0.1,
+		MinBoosted:   0.2,
+		HalfLife:     24 * time.Hour,
+		strikes:      map[string]strikeCount{},
+	}
+	p.SetRules(rules)
+	return p
+}
+
+// SetRules replaces the rules, highest score first
+func (p *Policy) SetRules(rules []Rule) {
+	sorted := append([]Rule(nil), rules...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].MinScore > sorted[j].MinScore })
+	p.mu.Lock()
+	p.Rules = sorted
+	p.mu.Unlock()
+}
+
+// Decide picks a response for a message from contact. An empty contact (the
+// owner testing with the sandbox trigger) never collects strikes.
+func (p *Policy) Decide(contact string, res Result, now time.Time) Verdict {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	v := Verdict{Score: res.Score, Effective: res.Score, Reasons: res.Reasons()}
+	if contact != "" {
+		v.Strikes = p.decayed(contact, now)
+		if res.Score >= p.MinBoosted {
+			v.Effective = math.Min(1, res.Score+v.Strikes*p.StrikeWeight)
+		}
+		if res.Score >= p.StrikeAt {
+			p.strikes[contact] = strikeCount{value: v.Strikes + 1, at: now}
+		}
+	}
+
+	v.Response = Reply
+	for _, r := range p.Rules {
+		if v.Effective >= r.MinScore {
+			v.Response = r.Response
+			v.Notify = r.Notify
+			break
+		}
+	}
+	return v
+}
+
+// Strikes returns a contact's current (decayed) strike count
+func (p *Policy) Strikes(contact string, now time.Time) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.decayed(contact, now)
+}
+
+// Forgive clears a contact's strikes
+func (p *Policy) Forgive(contact string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.strikes, contact)
+}
+
+// decayed applies the half-life; callers hold p.mu
+func (p *Policy) decayed(contact string, now time.Time) float64 {
+	s, ok := p.strikes[contact]
+	if !ok {
+		return 0
+	}
+	if p.HalfLife <= 0 {
+		return s.value
+	}
+	elapsed := now.Sub(s.at)
+	return s.value * math.Pow(0.5, float64(elapsed)/float64(p.HalfLife))
+}
@@ -0,0 +1,78 @@
+package defense
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("0.35:quote, 0.8:ignore+notify,0.6:deflect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPolicy(rules)
+	if p.Rules[0].Response != Ignore || !p.Rules[0].Notify || p.Rules[2].Response != Quote {
+		t.Errorf("rules not sorted/parsed: %+v", p.Rules)
+	}
+
+	for _, bad := range []string{"0.5", "x:ignore", "0.5:shout"} {
+		if _, err := ParseRules(bad); err == nil {
+			t.Errorf("ParseRules(%q) accepted", bad)
+		}
+	}
+}
+
+func TestPolicyResponses(t *testing.T) {
+	p := NewPolicy(DefaultRules)
+	now := time.Now()
+	cases := []struct {
+		score float64
+		want  Response
+	}{
+		{0.1, Reply},
+		{0.4, Quote},
+		{0.65, Deflect},
+		{0.9, Ignore},
+	}
+	for _, c := range cases {
+		if got := p.Decide("", Result{Score: c.score}, now).Response; got != c.want {
+			t.Errorf("score %.2f: got %s, want %s", c.score, got, c.want)
+		}
+	}
+}
+
+func TestStrikesEscalateAndDecay(t *testing.T) {
+	p := NewPolicy(DefaultRules)
+	now := time.Now()
+
+	// Same borderline message, repeated: quoted, then deflected, then ignored
+	want := []Response{Quote, Deflect, Deflect, Ignore}
+	for i, w := range want {
+		v := p.Decide("dana", Result{Score: 0.55}, now.Add(time.Duration(i)*time.Minute))
+		if v.Response != w {
+			t.Errorf("attempt %d: got %s (%s), want %s", i+1, v.Response, v.Summary(), w)
+		}
+	}
+
+	// Benign chat isn't punished for old strikes
+	if r := p.Decide("dana", Result{Score: 0.05}, now.Add(time.Hour)).Response; r != Reply {
+		t.Errorf("benign message with strikes: got %s, want reply", r)
+	}
+
+	// Another contact is unaffected
+	if r := p.Decide("noa", Result{Score: 0.55}, now).Response; r != Quote {
+		t.Errorf("other contact: got %s, want quote", r)
+	}
+
+	// Strikes halve every half-life
+	before := p.Strikes("dana", now.Add(3*time.Minute))
+	after := p.Strikes("dana", now.Add(3*time.Minute+p.HalfLife))
+	if diff := after - before/2; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("decay: %.3f → %.3f, want half", before, after)
+	}
+
+	p.Forgive("dana")
+	if s := p.Strikes("dana", now); s != 0 {
+		t.Errorf("strikes after Forgive: %.2f", s)
+	}
+}
@@ -0,0 +1,293 @@
+package defense
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Severity is how strongly a filter rule match suggests an injection
+type Severity string
+
+const (
+	Low    Severity = "low"    // Common in normal chat too ("reset", "act as")
+	Medium Severity = "medium" // Suspicious wording ("new persona")
+	High   Severity = "high"   // Practically only seen in attacks ("ignore previous")
+)
+
+// Score is the detection score a match of this severity contributes
+func (s Severity) Score() float64 {
+	switch s {
+	case High:
+		return 1
+	case Medium:
+		return 0.6
+	case Low:
+		return 0.3
+	}
+	return 0
+}
+
+// FilterRule is one entry of the filter rule file. Exactly one of Phrase
+// (case-insensitive substring) or Regex is set.
+type FilterRule struct {
+	Phrase    string   `json:"phrase,omitempty"`
+	Regex     string   `json:"regex,omitempty"`
+	Severity  Severity `json:"severity"`
+	Languages []string `json:"languages,omitempty"` // Empty = any language
+	Detect    bool     `json:"detect"`              // Counts towards the keyword score
+	Filter    bool     `json:"filter"`              // Removed from the text the persona sees
+}
+
+// Name identifies the rule in logs
+func (r FilterRule) Name() string {
+	if r.Phrase != "" {
+		return r.Phrase
+	}
+	return "/" + r.Regex + "/"
+}
+
+// appliesTo reports whether the rule is active for a message in any of
+// langs (none or "" = any language)
+func (r FilterRule) appliesTo(langs []string) bool {
+	if len(langs) == 0 || len(r.Languages) == 0 {
+		return true
+	}
+	for _, lang := range langs {
+		if lang == "" {
+			return true
+		}
+		for _, l := range r.Languages {
+			if strings.EqualFold(l, lang) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type ruleFile struct {
+	Rules []FilterRule `json:"rules"`
+}
+
+//go:embed filter_rules.json
+var defaultRulesJSON []byte
+
+// RuleMatch is one rule occurrence as byte offsets into the text
+type RuleMatch struct {
+	Rule       *FilterRule
+	Start, End int
+}
+
+// RuleSet is a compiled set of filter rules. Phrases share one Aho-Corasick
+// automaton. Regexes are also joined into one alternation that screens the
+// message in a single pass; only when it matches are the rules run one by
+// one, so overlapping rules can't hide each other's matches.
+type RuleSet struct {
+	Rules    []FilterRule
+	phrases  *ahoCorasick
+	byPhrase []int // Automaton pattern → rule index
+	screen   *regexp.Regexp
+	regexes  []*regexp.Regexp
+	byRegex  []int // regexes index → rule index
+}
+
+// CompileRules validates and compiles rules
+func CompileRules(rules []FilterRule) (*RuleSet, error) {
+	rs := &RuleSet{Rules: rules}
+	var phrases, alternatives []string
+	for i, r := range rules {
+		if (r.Phrase == "") == (r.Regex == "") {
+			return nil, fmt.Errorf("rule %d: set exactly one of phrase or regex", i)
+		}
+		if r.Severity.Score() == 0 {
+			return nil, fmt.Errorf("rule %q: severity must be low, medium or high", r.Name())
+		}
+		if r.Phrase != "" {
+			phrases = append(phrases, r.Phrase)
+			rs.byPhrase = append(rs.byPhrase, i)
+			continue
+		}
+		re, err := regexp.Compile(`(?i)` + r.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %v", r.Name(), err)
+		}
+		rs.regexes = append(rs.regexes, re)
+		rs.byRegex = append(rs.byRegex, i)
+		alternatives = append(alternatives, "(?:"+r.Regex+")")
+	}
+	rs.phrases = newAhoCorasick(phrases)
+	if len(alternatives) > 0 {
+		rs.screen = regexp.MustCompile(`(?i)` + strings.Join(alternatives, "|"))
+	}
+	return rs, nil
+}
+
+// ParseRuleFile compiles the JSON rule file format
+func ParseRuleFile(data []byte) (*RuleSet, error) {
+	var f ruleFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	return CompileRules(f.Rules)
+}
+
+// DefaultRuleSet is the rule file shipped with the bot (filter_rules.json)
+func DefaultRuleSet() *RuleSet {
+	rs, err := ParseRuleFile(defaultRulesJSON)
+	if err != nil {
+		panic("defense: bad embedded filter_rules.json: " + err.Error())
+	}
+	return rs
+}
+
+// Find returns every match of the rules active for any of langs (none or
+// "" = all rules). Messages often mix languages, so pass all of them.
+func (rs *RuleSet) Find(text string, langs ...string) []RuleMatch {
+	var matches []RuleMatch
+	for _, m := range rs.phrases.findAll(text) {
+		r := &rs.Rules[rs.byPhrase[m.Pattern]]
+		if r.appliesTo(langs) {
+			matches = append(matches, RuleMatch{Rule: r, Start: m.Start, End: m.End})
+		}
+	}
+	if rs.screen == nil || !rs.screen.MatchString(text) {
+		return matches
+	}
+	for k, re := range rs.regexes {
+		r := &rs.Rules[rs.byRegex[k]]
+		if !r.appliesTo(langs) {
+			continue
+		}
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			matches = append(matches, RuleMatch{Rule: r, Start: loc[0], End: loc[1]})
+		}
+	}
+	return matches
+}
+
+// Score is the highest severity among detect rules found in text, with the
+// names of the rules that matched
+func (rs *RuleSet) Score(text string, langs ...string) (float64, []string) {
+	var score float64
+	var reasons []string
+	seen := map[*FilterRule]bool{}
+	for _, m := range rs.Find(text, langs...) {
+		if !m.Rule.Detect || seen[m.Rule] {
+			continue
+		}
+		seen[m.Rule] = true
+		score = max(score, m.Rule.Severity.Score())
+		reasons = append(reasons, m.Rule.Name())
+	}
+	return score, reasons
+}
+
+var whitespaceRun = regexp.MustCompile(`\s+`)
+
+// Filter removes every filter rule match from text and tidies the spaces
+// left behind
+func (rs *RuleSet) Filter(text string, langs ...string) string {
+	var spans [][2]int
+	for _, m := range rs.Find(text, langs...) {
+		if m.Rule.Filter {
+			spans = append(spans, [2]int{m.Start, m.End})
+		}
+	}
+	if len(spans) > 0 {
+		sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+		var b strings.Builder
+		pos := 0
+		for _, s := range spans {
+			if s[0] > pos {
+				b.WriteString(text[pos:s[0]])
+			}
+			pos = max(pos, s[1])
+		}
+		b.WriteString(text[pos:])
+		text = b.String()
+	}
+	return strings.TrimSpace(whitespaceRun.ReplaceAllString(text, " "))
+}
+
+// RuleSource holds the active RuleSet and swaps in a new one when the rule
+// file changes on disk
+type RuleSource struct {
+	path    string
+	current atomic.Pointer[RuleSet]
+	modTime time.Time
+}
+
+// NewRuleSource starts out with rs until Load points it at a file
+func NewRuleSource(rs *RuleSet) *RuleSource {
+	src := &RuleSource{}
+	src.current.Store(rs)
+	return src
+}
+
+// Load switches to the rules in path. A missing file keeps the current
+// rules; Watch picks the file up if it appears later.
+func (s *RuleSource) Load(path string) error {
+	s.path = path
+	if _, err := s.reload(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Rules returns the rule set currently in force
+func (s *RuleSource) Rules() *RuleSet {
+	return s.current.Load()
+}
+
+// reload compiles the file if its mtime changed. A broken file keeps the
+// previous rules.
+func (s *RuleSource) reload() (bool, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(s.modTime) {
+		return false, nil
+	}
+	s.modTime = info.ModTime()
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return false, err
+	}
+	rs, err := ParseRuleFile(data)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", s.path, err)
+	}
+	s.current.Store(rs)
+	return true, nil
+}
+
+// Watch polls the rule file every interval until stop is closed. Call it
+// after Load, from a single goroutine.
+func (s *RuleSource) Watch(interval time.Duration, stop <-chan struct{}) {
+	if s.path == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			changed, err := s.reload()
+			if err != nil && !os.IsNotExist(err) {
+				fmt.Printf("⚠️  Filter rules not reloaded, keeping previous: %v\n", err)
+			} else if changed {
+				fmt.Printf("🔄 Reloaded %d filter rules from %s\n", len(s.Rules().Rules), s.path)
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package drafts
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Command is an owner decision typed in the terminal or the self-chat:
+//
+//	ok [id]          send the draft as generated
+//	edit [id] text   send text instead
+//	no [id]          drop the draft
+//
+// The ID may be left out to act on the latest draft.
+type Command struct {
+	Action Action
+	ID     string
+	Text   string
+}
+
+var commandWords = map[string]Action{
+	"ok":     Approve,
+	"yes":    Approve,
+	"send":   Approve,
+	"edit":   Edit,
+	"no":     Reject,
+	"drop":   Reject,
+	"reject": Reject,
+}
+
+// ParseCommand recognises a draft command. ok is false for ordinary text.
+func ParseCommand(line string) (cmd Command, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return Command{}, false
+	}
+	action, known := commandWords[strings.ToLower(fields[0])]
+	if !known {
+		return Command{}, false
+	}
+	cmd.Action = action
+	rest := fields[1:]
+	if len(rest) > 0 && isID(rest[0]) {
+		cmd.ID = rest[0]
+		rest = rest[1:]
+	}
+	if action == Edit {
+		if len(rest) == 0 {
+			return Command{}, false
+		}
+		cmd.Text = strings.Join(rest, " ")
+	} else if len(rest) > 0 {
+		return Command{}, false // "ok then" is conversation, not a command
+	}
+	return cmd, true
+}
+
+func isID(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Apply runs a parsed command against the queue
+func (q *Queue) Apply(cmd Command) (Draft, error) {
+	var d Draft
+	var ok bool
+	if cmd.ID == "" {
+		d, ok = q.Latest()
+	} else {
+		d, ok = q.Get(cmd.ID)
+	}
+	if !ok {
+		return Draft{}, ErrUnknownDraft
+	}
+	return d, q.Resolve(d.ID, cmd.Action, cmd.Text)
+}
+
+// Prompt is the text shown to the owner for a new draft
+func Prompt(d Draft, contact string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📝 Draft #%s for %s", d.ID, contact)
+	if d.Context != "" {
+		fmt.Fprintf(&b, "\nThey said: %s", d.Context)
+	}
+	fmt.Fprintf(&b, "\nReply: %s", d.Text)
+	fmt.Fprintf(&b, "\n\n→ ok %s | edit %s <text> | no %s", d.ID, d.ID, d.ID)
+	if !d.Deadline.IsZero() {
+		fmt.Fprintf(&b, "\n(decides itself at %s)", d.Deadline.Format("15:04"))
+	}
+	return b.String()
+}
@@ -0,0 +1,218 @@
+// Package drafts holds generated replies until the owner approves, edits or
+// rejects them, with a timeout policy for drafts nobody answers.
+package drafts
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownDraft is returned when a draft ID isn't pending
+var ErrUnknownDraft = errors.New("unknown draft")
+
+// Action is how a draft was resolved
+type Action string
+
+const (
+	Approve     Action = "approve"      // Send as generated
+	Edit        Action = "edit"         // Send the owner's text instead
+	Reject      Action = "reject"       // Never send
+	TimeoutSend Action = "timeout_send" // Nobody answered, sent as generated
+	TimeoutDrop Action = "timeout_drop" // Nobody answered, dropped
+)
+
+// Sends reports whether the action results in a message going out
+func (a Action) Sends() bool {
+	return a == Approve || a == Edit || a == TimeoutSend
+}
+
+// TimeoutPolicy decides what happens to a draft nobody answers in time
+type TimeoutPolicy string
+
+const (
+	PolicySend TimeoutPolicy = "send"
+	PolicyDrop TimeoutPolicy = "drop"
+	PolicyWait TimeoutPolicy = "wait" // Keep it pending forever
+)
+
+// ParsePolicy reads a policy name, defaulting to PolicyDrop
+func ParsePolicy(s string) (TimeoutPolicy, error) {
+	switch TimeoutPolicy(strings.ToLower(strings.TrimSpace(s))) {
+	case "", PolicyDrop:
+		return PolicyDrop, nil
+	case PolicySend:
+		return PolicySend, nil
+	case PolicyWait:
+		return PolicyWait, nil
+	}
+	return PolicyDrop, errors.New("unknown timeout policy " + strconv.Quote(s) + " (want send, drop or wait)")
+}
+
+// Draft is a generated reply waiting for a decision
+type Draft struct {
+	ID        string
+	Chat      string
+	Text      string
+	Context   string // The incoming message the reply answers
+	ReplyTo   string // That message's ID, "" if unknown
+	CreatedAt time.Time
+	Deadline  time.Time // Zero when the policy is PolicyWait
+}
+
+// Resolution is the outcome handed to the Handler
+type Resolution struct {
+	Action Action
+	Text   string // What to send (the edit for Edit, the draft text otherwise)
+}
+
+// Handler carries out a resolution. If it fails on a sending action the draft
+// goes back in the queue so the owner can retry. A draft the timeout fails to
+// send maxTimeoutSends times is dropped instead.
+type Handler func(d Draft, res Resolution) error
+
+// maxTimeoutSends caps how often the timeout tries to send a draft
+const maxTimeoutSends = 3
+
+// Queue holds pending drafts
+type Queue struct {
+	mu      sync.Mutex
+	pending map[string]*entry
+	nextID  int
+	timeout time.Duration
+	policy  TimeoutPolicy
+	handle  Handler
+}
+
+type entry struct {
+	draft  Draft
+	timer  *time.Timer
+	failed int // Failed timeout sends
+}
+
+// NewQueue creates a queue. A zero timeout behaves like PolicyWait.
+func NewQueue(timeout time.Duration, policy TimeoutPolicy, handle Handler) *Queue {
+	if timeout <= 0 {
+		policy = PolicyWait
+	}
+	return &Queue{
+		pending: map[string]*entry{},
+		timeout: timeout,
+		policy:  policy,
+		handle:  handle,
+	}
+}
+
+// Add queues a draft and starts its timeout. IDs are short numbers so they can
+// be typed from a phone.
+func (q *Queue) Add(chat, text, context, replyTo string) Draft {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.nextID++
+	d := Draft{
+		ID:        strconv.Itoa(q.nextID),
+		Chat:      chat,
+		Text:      text,
+		Context:   context,
+		ReplyTo:   replyTo,
+		CreatedAt: time.Now(),
+	}
+	e := &entry{draft: d}
+	q.pending[d.ID] = e
+	q.arm(e)
+	return e.draft
+}
+
+// arm starts the timeout for an entry; callers hold q.mu
+func (q *Queue) arm(e *entry) {
+	if q.policy == PolicyWait {
+		return
+	}
+	e.draft.Deadline = time.Now().Add(q.timeout)
+	id := e.draft.ID
+	e.timer = time.AfterFunc(q.timeout, func() {
+		action := TimeoutDrop
+		if q.policy == PolicySend {
+			action = TimeoutSend
+		}
+		q.Resolve(id, action, "")
+	})
+}
+
+// Resolve applies an owner decision (or a timeout) to a pending draft
+func (q *Queue) Resolve(id string, action Action, text string) error {
+	q.mu.Lock()
+	e, ok := q.pending[id]
+	if !ok {
+		q.mu.Unlock()
+		return ErrUnknownDraft
+	}
+	delete(q.pending, id)
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	q.mu.Unlock()
+
+	text = strings.TrimSpace(text)
+	if action == Edit && (text == "" || text == e.draft.Text) {
+		action = Approve
+	}
+	if action != Edit {
+		text = e.draft.Text
+	}
+
+	err := q.handle(e.draft, Resolution{Action: action, Text: text})
+	if err != nil && action == TimeoutSend {
+		if e.failed++; e.failed >= maxTimeoutSends {
+			q.handle(e.draft, Resolution{Action: TimeoutDrop, Text: e.draft.Text})
+			return err
+		}
+	}
+	if err != nil && action.Sends() {
+		q.mu.Lock()
+		q.pending[id] = e
+		q.arm(e)
+		q.mu.Unlock()
+	}
+	return err
+}
+
+// Get returns a pending draft
+func (q *Queue) Get(id string) (Draft, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.pending[id]
+	if !ok {
+		return Draft{}, false
+	}
+	return e.draft, true
+}
+
+// Latest returns the most recently queued pending draft
+func (q *Queue) Latest() (Draft, bool) {
+	list := q.Pending()
+	if len(list) == 0 {
+		return Draft{}, false
+	}
+	return list[len(list)-1], true
+}
+
+// Pending lists drafts oldest first, by ID: drafts made in the same clock
+// tick have the same CreatedAt
+func (q *Queue) Pending() []Draft {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := make([]Draft, 0, len(q.pending))
+	for _, e := range q.pending {
+		list = append(list, e.draft)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, _ := strconv.Atoi(list[i].ID)
+		b, _ := strconv.Atoi(list[j].ID)
+		return a < b
+	})
+	return list
+}
@@ -0,0 +1,199 @@
+package drafts
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a Handler that remembers what it was asked to do
+type recorder struct {
+	mu   sync.Mutex
+	got  []Resolution
+	fail func(Resolution) bool
+}
+
+func (r *recorder) handle(d Draft, res Resolution) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.got = append(r.got, res)
+	if r.fail != nil && r.fail(res) {
+		return errors.New("send failed")
+	}
+	return nil
+}
+
+func (r *recorder) actions() []Action {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []Action
+	for _, res := range r.got {
+		out = append(out, res.Action)
+	}
+	return out
+}
+
+func TestResolve(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		action Action
+		text   string
+		want   Resolution
+	}{
+		{"approve", Approve, "", Resolution{Approve, "see you"}},
+		{"edit", Edit, " see ya! ", Resolution{Edit, "see ya!"}},
+		{"empty edit approves", Edit, "  ", Resolution{Approve, "see you"}},
+		{"same edit approves", Edit, "see you", Resolution{Approve, "see you"}},
+		{"reject", Reject, "ignored", Resolution{Reject, "see you"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			r := &recorder{}
+			q := NewQueue(0, PolicyWait, r.handle)
+			d := q.Add("chat", "see you", "bye", "")
+			if err := q.Resolve(d.ID, c.action, c.text); err != nil {
+				t.Fatal(err)
+			}
+			if len(r.got) != 1 || r.got[0] != c.want {
+				t.Errorf("handled %+v, want %+v", r.got, c.want)
+			}
+			if _, ok := q.Get(d.ID); ok {
+				t.Error("draft still pending")
+			}
+			if err := q.Resolve(d.ID, Approve, ""); !errors.Is(err, ErrUnknownDraft) {
+				t.Errorf("second Resolve = %v, want ErrUnknownDraft", err)
+			}
+		})
+	}
+}
+
+func TestFailedSendRequeues(t *testing.T) {
+	r := &recorder{fail: func(res Resolution) bool { return res.Action.Sends() }}
+	q := NewQueue(0, PolicyWait, r.handle)
+	d := q.Add("chat", "hi", "", "")
+	if err := q.Resolve(d.ID, Approve, ""); err == nil {
+		t.Fatal("failed send not reported")
+	}
+	if _, ok := q.Get(d.ID); !ok {
+		t.Fatal("draft not back in the queue")
+	}
+	r.fail = nil
+	if err := q.Resolve(d.ID, Reject, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitFor polls until cond holds or a second passes
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("timed out")
+}
+
+func TestTimeout(t *testing.T) {
+	for _, c := range []struct {
+		policy TimeoutPolicy
+		want   Action
+	}{
+		{PolicySend, TimeoutSend},
+		{PolicyDrop, TimeoutDrop},
+	} {
+		r := &recorder{}
+		q := NewQueue(10*time.Millisecond, c.policy, r.handle)
+		d := q.Add("chat", "hi", "", "")
+		if d.Deadline.IsZero() {
+			t.Errorf("%s: no deadline", c.policy)
+		}
+		waitFor(t, func() bool { return len(r.actions()) == 1 })
+		if got := r.actions()[0]; got != c.want {
+			t.Errorf("%s: timed out as %s, want %s", c.policy, got, c.want)
+		}
+		if len(q.Pending()) != 0 {
+			t.Errorf("%s: draft still pending", c.policy)
+		}
+	}
+}
+
+func TestTimeoutSendGivesUp(t *testing.T) {
+	r := &recorder{fail: func(res Resolution) bool { return res.Action == TimeoutSend }}
+	q := NewQueue(5*time.Millisecond, PolicySend, r.handle)
+	q.Add("chat", "hi", "", "")
+	waitFor(t, func() bool { return len(r.actions()) == maxTimeoutSends+1 })
+	time.Sleep(20 * time.Millisecond)
+	got := r.actions()
+	if len(got) != maxTimeoutSends+1 || got[len(got)-1] != TimeoutDrop {
+		t.Errorf("handled %v, want %d failed sends then a drop", got, maxTimeoutSends)
+	}
+	if len(q.Pending()) != 0 {
+		t.Error("draft still pending")
+	}
+}
+
+func TestWaitPolicy(t *testing.T) {
+	q := NewQueue(time.Millisecond, PolicyWait, (&recorder{}).handle)
+	d := q.Add("chat", "hi", "", "")
+	time.Sleep(10 * time.Millisecond)
+	if !d.Deadline.IsZero() || len(q.Pending()) != 1 {
+		t.Error("PolicyWait draft timed out")
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	for _, c := range []struct {
+		line string
+		want Command
+		ok   bool
+	}{
+		{"ok", Command{Action: Approve}, true},
+		{"OK 12", Command{Action: Approve, ID: "12"}, true},
+		{"edit 3 see you at 8", Command{Action: Edit, ID: "3", Text: "see you at 8"}, true},
+		{"edit see you", Command{Action: Edit, Text: "see you"}, true},
+		{"no", Command{Action: Reject}, true},
+		{"edit", Command{}, false},
+		{"ok then", Command{}, false},
+		{"hello", Command{}, false},
+	} {
+		got, ok := ParseCommand(c.line)
+		if ok != c.ok || got != c.want {
+			t.Errorf("ParseCommand(%q) = %+v %v, want %+v %v", c.line, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestApplyLatest(t *testing.T) {
+	r := &recorder{}
+	q := NewQueue(0, PolicyWait, r.handle)
+	q.Add("chat", "first", "", "")
+	q.Add("chat", "second", "", "")
+	d, err := q.Apply(Command{Action: Approve})
+	if err != nil || d.Text != "second" {
+		t.Errorf("Apply latest = %+v %v, want the second draft", d, err)
+	}
+	if _, err := q.Apply(Command{Action: Approve, ID: "99"}); !errors.Is(err, ErrUnknownDraft) {
+		t.Errorf("Apply unknown = %v", err)
+	}
+}
+
+// Drafts made in the same clock tick still list in order, "10" after "9"
+func TestPendingOrder(t *testing.T) {
+	q := NewQueue(0, PolicyWait, (&recorder{}).handle)
+	var want []string
+	for i := 1; i <= 12; i++ {
+		want = append(want, q.Add("chat", "hi", "", "").ID)
+	}
+	var got []string
+	for _, d := range q.Pending() {
+		got = append(got, d.ID)
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if d, _ := q.Latest(); d.ID != "12" {
+		t.Errorf("latest: got #%s, want #12", d.ID)
+	}
+}
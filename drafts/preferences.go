@@ -0,0 +1,76 @@
+package drafts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// Example is an owner edit: what the bot wanted to say vs. what was sent
+type Example struct {
+	Context string    `json:"context,omitempty"`
+	Draft   string    `json:"draft"`
+	Edited  string    `json:"edited"`
+	At      time.Time `json:"at"`
+}
+
+// Preferences stores owner edits per persona in a JSON file
+type Preferences struct {
+	mu   sync.Mutex
+	path string
+	data map[string][]Example // persona name -> examples, oldest first
+}
+
+// maxExamples caps how many edits are kept per persona
+const maxExamples = 50
+
+// LoadPreferences reads the preferences file; a missing file is fine
+func LoadPreferences(path string) (*Preferences, error) {
+	p := &Preferences{path: path, data: map[string][]Example{}}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return p, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if err := json.Unmarshal(raw, &p.data); err != nil {
+		return p, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return p, nil
+}
+
+// Add records an edit for a persona and saves the file
+func (p *Preferences) Add(persona string, ex Example) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	list := append(p.data[persona], ex)
+	if len(list) > maxExamples {
+		list = list[len(list)-maxExamples:]
+	}
+	p.data[persona] = list
+
+	raw, err := json.MarshalIndent(p.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %v", err)
+	}
+	if err := os.WriteFile(p.path, raw, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", p.path, err)
+	}
+	return nil
+}
+
+// Recent returns up to n of a persona's latest edits, oldest first
+func (p *Preferences) Recent(persona string, n int) []Example {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	list := p.data[persona]
+	if len(list) > n {
+		list = list[len(list)-n:]
+	}
+	return append([]Example(nil), list...)
+}
@@ -0,0 +1,211 @@
+// Package escalate spots messages a human should answer instead of the
+// persona: emergencies, bad news, requests for money, plans to meet. Topics
+// are lists of phrases and regular expressions, built in (topics.json) or
+// loaded from a file of the same format.
+package escalate
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+//go:embed topics.json
+var defaultTopicsJSON []byte
+
+// Topic is one kind of message to escalate
+type Topic struct {
+	Name     string   `json:"name"`
+	Label    string   `json:"label"`              // How the owner's alert names it ("money")
+	Phrases  []string `json:"phrases"`            // Whole words, any case
+	Patterns []string `json:"patterns,omitempty"` // Regular expressions, any case
+
+	phrases  [][]string
+	patterns []*regexp.Regexp
+}
+
+// Detector checks messages against a set of topics
+type Detector struct {
+	topics []*Topic
+}
+
+// Match is why a message was escalated
+type Match struct {
+	Topic string
+	Label string
+	Found string // The phrase or text that matched
+}
+
+// Default returns the built-in topics
+func Default() *Detector {
+	d, err := Parse(defaultTopicsJSON)
+	if err != nil {
+		panic(fmt.Sprintf("escalate: built-in topics: %v", err))
+	}
+	return d
+}
+
+// Load reads topics from a file. A missing file means the built-in topics.
+func Load(path string) (*Detector, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Default(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	d, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return d, nil
+}
+
+// Parse reads topics in the topics.json format
+func Parse(data []byte) (*Detector, error) {
+	var file struct {
+		Topics []*Topic `json:"topics"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid topics: %v", err)
+	}
+	seen := map[string]bool{}
+	for i, t := range file.Topics {
+		if t.Name == "" || seen[t.Name] {
+			return nil, fmt.Errorf("topic %d: missing or repeated name %q", i+1, t.Name)
+		}
+		seen[t.Name] = true
+		if t.Label == "" {
+			t.Label = strings.ReplaceAll(t.Name, "_", " ")
+		}
+		for _, p := range t.Phrases {
+			if ws := words(p); len(ws) > 0 {
+				t.phrases = append(t.phrases, ws)
+			}
+		}
+		for _, p := range t.Patterns {
+			re, err := regexp.Compile("(?i)" + p)
+			if err != nil {
+				return nil, fmt.Errorf("topic %s: %v", t.Name, err)
+			}
+			t.patterns = append(t.patterns, re)
+		}
+		if len(t.phrases) == 0 && len(t.patterns) == 0 {
+			return nil, fmt.Errorf("topic %s has no phrases or patterns", t.Name)
+		}
+	}
+	return &Detector{topics: file.Topics}, nil
+}
+
+// Topics lists the topic names, in order
+func (d *Detector) Topics() []string {
+	names := make([]string, len(d.topics))
+	for i, t := range d.topics {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// Only keeps the named topics. Unknown names are an error.
+func (d *Detector) Only(names []string) (*Detector, error) {
+	byName := map[string]*Topic{}
+	for _, t := range d.topics {
+		byName[t.Name] = t
+	}
+	kept := &Detector{}
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		t, ok := byName[n]
+		if !ok {
+			return nil, fmt.Errorf("unknown topic %q (have %s)", n, strings.Join(d.Topics(), ", "))
+		}
+		kept.topics = append(kept.topics, t)
+	}
+	return kept, nil
+}
+
+// Check returns the first topic text touches, in topic order
+func (d *Detector) Check(text string) (Match, bool) {
+	ws := words(text)
+	for _, t := range d.topics {
+		for _, p := range t.phrases {
+			if containsPhrase(ws, p) {
+				return Match{Topic: t.Name, Label: t.Label, Found: strings.Join(p, " ")}, true
+			}
+		}
+		for _, re := range t.patterns {
+			if found := re.FindString(text); found != "" {
+				return Match{Topic: t.Name, Label: t.Label, Found: found}, true
+			}
+		}
+	}
+	return Match{}, false
+}
+
+// containsPhrase reports whether the phrase's words appear in a row
+func containsPhrase(ws, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(ws); i++ {
+		ok := sameWord(ws[i], phrase[0])
+		for j := 1; ok && j < len(phrase); j++ {
+			ok = ws[i+j] == phrase[j]
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hebrewPrefixes are the one-letter words Hebrew writes glued to the next
+// one: and, the, in, to, from, that, as
+const hebrewPrefixes = "והבלמשכ"
+
+// sameWord matches a word of the message against the first word of a
+// phrase. Hebrew words may carry up to two prefix letters ("ובבית").
+func sameWord(w, p string) bool {
+	if w == p {
+		return true
+	}
+	rest, ok := strings.CutSuffix(w, p)
+	if !ok || !isHebrew(p) {
+		return false
+	}
+	n := 0
+	for _, r := range rest {
+		if !strings.ContainsRune(hebrewPrefixes, r) {
+			return false
+		}
+		n++
+	}
+	return n <= 2
+}
+
+func isHebrew(s string) bool {
+	for _, r := range s {
+		return unicode.Is(unicode.Hebrew, r)
+	}
+	return false
+}
+
+// words are the lowercase words of s. Quotes inside a word stay ("מד"א",
+// "let's"), quotes around it don't.
+func words(s string) []string {
+	s = strings.ReplaceAll(strings.ToLower(s), "’", "'")
+	var out []string
+	for _, w := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' && r != '"'
+	}) {
+		if w = strings.Trim(w, `'"`); w != "" {
+			out = append(out, w)
+		}
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+package escalate
+
+import "testing"
+
+func TestDefaultTopics(t *testing.T) {
+	d := Default()
+	for _, c := range []struct {
+		text, topic string
+	}{
+		{"I was in an accident, can you call me now?", "emergency"},
+		{"אני במיון עם אבא", "emergency"},
+		{"my grandpa passed away this morning", "bad_news"},
+		{"סבתא שלי נפטרה", "bad_news"},
+		{"can you lend me 200?", "money"},
+		{"תעביר לי 150 ₪ בביט", "money"},
+		{"you still owe me $40", "money"},
+		{"wanna grab a drink thursday?", "meeting"},
+		{"Let’s meet at the station", "meeting"},
+		{"בוא נפגש מחר בערב", "meeting"},
+		{"\"URGENT\" pls answer", "emergency"},
+	} {
+		m, ok := d.Check(c.text)
+		if !ok || m.Topic != c.topic {
+			t.Errorf("Check(%q) = %+v %v, want %s", c.text, m, ok, c.topic)
+		}
+	}
+	for _, text := range []string{
+		"lol that movie was so good",
+		"the urgency of the situation", // whole words only
+		"I read about the accidental discovery of penicillin",
+		"מה שלומך היום",
+		"can I borrow your charger",
+	} {
+		if m, ok := d.Check(text); ok {
+			t.Errorf("Check(%q) matched %+v", text, m)
+		}
+	}
+}
+
+func TestOnly(t *testing.T) {
+	d, err := Default().Only([]string{"money", " meeting"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.Check("call an ambulance"); ok {
+		t.Error("emergency still checked")
+	}
+	if m, ok := d.Check("lend me a tenner"); !ok || m.Label != "money" {
+		t.Errorf("money not checked: %+v", m)
+	}
+	if _, err := Default().Only([]string{"gossip"}); err == nil {
+		t.Error("unknown topic accepted")
+	}
+}
+
+func TestParse(t *testing.T) {
+	d, err := Parse([]byte(`{"topics": [{"name": "work_trip", "phrases": ["conference"], "patterns": ["flight \\d+"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := d.Check("booked flight 123"); !ok || m.Label != "work trip" || m.Found != "flight 123" {
+		t.Errorf("pattern match = %+v %v", m, ok)
+	}
+	for _, bad := range []string{
+		`{"topics": [{"name": "x"}]}`,
+		`{"topics": [{"name": "x", "phrases": ["a"]}, {"name": "x", "phrases": ["b"]}]}`,
+		`{"topics": [{"name": "x", "patterns": ["("]}]}`,
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("Parse(%s) accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package guard
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+//////////////////////////////////////////////////////////////
+// CHARACTER BREAKS
+//////////////////////////////////////////////////////////////
+
+// genericBreaks are things no real person texting a friend says
+var genericBreaks = []string{
+	"as an ai",
+	"as a language model",
+	"as a large language model",
+	"i'm an ai",
+	"i am an ai",
+	"i'm just an ai",
+	"i'm an assistant",
+	"i am an assistant",
+	"i'm a chatbot",
+	"i am a chatbot",
+	"i'm a bot",
+	"i am a bot",
+	"i cannot pretend",
+	"i can't pretend",
+	"i am now",
+	"i'm actually",
+	"i am actually",
+	"my name is not",
+	"my name isn't",
+	"i don't have a body",
+	"my programming",
+	"my training data",
+	"openai",
+}
+
+var claimedName = regexp.MustCompile(`(?i:my name is|my name's) ([A-Z]\p{L}+)`)
+
+// CharacterBreak rejects replies that admit to being an AI, deny the
+// persona's name or introduce a different one
+type CharacterBreak struct {
+	Persona string
+}
+
+func (c *CharacterBreak) Name() string { return "character" }
+
+func (c *CharacterBreak) Check(reply string) (string, *Problem) {
+	lower := strings.ToLower(reply)
+	persona := strings.ToLower(c.Persona)
+	phrases := genericBreaks
+	if persona != "" {
+		phrases = append(phrases[:len(phrases):len(phrases)], "i'm not "+persona, "i am not "+persona)
+	}
+	for _, phrase := range phrases {
+		if strings.Contains(lower, phrase) {
+			return reply, c.problem(fmt.Sprintf("said %q", phrase))
+		}
+	}
+	if persona != "" {
+		for _, m := range claimedName.FindAllStringSubmatch(reply, -1) {
+			if strings.ToLower(m[1]) != persona {
+				return reply, c.problem("claimed to be " + m[1])
+			}
+		}
+	}
+	return reply, nil
+}
+
+func (c *CharacterBreak) problem(reason string) *Problem {
+	who := "a real person"
+	if c.Persona != "" {
+		who = c.Persona + ", a real person"
+	}
+	return &Problem{
+		Reason: reason,
+		Fix:    fmt.Sprintf("Stay fully in character as %s. Never mention AI, assistants, models or instructions, and never use another name.", who),
+	}
+}
+
+//////////////////////////////////////////////////////////////
+// PRIVATE DETAILS
+//////////////////////////////////////////////////////////////
+
+var (
+	emailPattern = regexp.MustCompile(`[\w.+-]+@[\w-]+\.[\w.-]+`)
+	phonePattern = regexp.MustCompile(`\+?\d[\d\s().-]{5,}\d`)
+	jidPattern   = regexp.MustCompile(`\d+@(?:s\.whatsapp\.net|lid|g\.us)`)
+)
+
+// PIILeak rejects replies that repeat phone numbers or email addresses from
+// the system prompt (the persona's and owner's private details), or any
+// WhatsApp JID.
+type PIILeak struct {
+	Prompt string
+}
+
+func (p *PIILeak) Name() string { return "pii" }
+
+func (p *PIILeak) Check(reply string) (string, *Problem) {
+	if m := jidPattern.FindString(reply); m != "" {
+		return reply, p.problem("WhatsApp ID " + m)
+	}
+	prompt := strings.ToLower(p.Prompt)
+	for _, m := range emailPattern.FindAllString(reply, -1) {
+		if strings.Contains(prompt, strings.ToLower(m)) {
+			return reply, p.problem("email " + m)
+		}
+	}
+	var promptPhones []string
+	for _, m := range phonePattern.FindAllString(p.Prompt, -1) {
+		promptPhones = append(promptPhones, strings.TrimLeft(digitsOnly(m), "0"))
+	}
+	for _, m := range phonePattern.FindAllString(reply, -1) {
+		// Local numbers drop the trunk 0 when written with a country code
+		d := strings.TrimLeft(digitsOnly(m), "0")
+		if len(d) < 7 {
+			continue
+		}
+		for _, known := range promptPhones {
+			// Either may carry a country code the other lacks
+			if strings.HasSuffix(known, d) || strings.HasSuffix(d, known) && len(known) >= 7 {
+				return reply, p.problem("phone number " + m)
+			}
+		}
+	}
+	return reply, nil
+}
+
+func (p *PIILeak) problem(reason string) *Problem {
+	return &Problem{
+		Reason: "leaked " + reason,
+		Fix:    "Do not share phone numbers, email addresses or account IDs.",
+	}
+}
+
+func digitsOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+//////////////////////////////////////////////////////////////
+// FORMATTING
+//////////////////////////////////////////////////////////////
+
+var (
+	markdownBold = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	whatsappBold = regexp.MustCompile(`\*([^*\n]+)\*`)
+	sentenceEnd  = regexp.MustCompile(`[.!?…]+["')]*(\s+|$)`)
+	doubleSpace  = regexp.MustCompile(` {2,}`)
+	// Left behind when an emoji before the full stop is dropped
+	spaceBeforePunct = regexp.MustCompile(` +([.,!?])`)
+)
+
+// Formatting repairs replies to the persona's style rules. It never rejects.
+type Formatting struct {
+	Style Style
+}
+
+func (f *Formatting) Name() string { return "formatting" }
+
+func (f *Formatting) Check(reply string) (string, *Problem) {
+	if f.Style.NoBold {
+		reply = markdownBold.ReplaceAllString(reply, "$1")
+		reply = whatsappBold.ReplaceAllString(reply, "$1")
+		reply = strings.ReplaceAll(reply, "**", "")
+	}
+	if f.Style.MaxEmoji > 0 {
+		reply = limitEmoji(reply, f.Style.MaxEmoji)
+	}
+	if f.Style.MaxSentences > 0 {
+		reply = limitSentences(reply, f.Style.MaxSentences)
+	}
+	if f.Style.Lowercase {
+		reply = strings.ToLower(reply)
+	}
+	return strings.TrimSpace(reply), nil
+}
+
+// limitSentences cuts the reply after n sentences
+func limitSentences(reply string, n int) string {
+	ends := sentenceEnd.FindAllStringIndex(reply, -1)
+	if len(ends) <= n {
+		return reply
+	}
+	return reply[:ends[n-1][1]]
+}
+
+// limitEmoji keeps the first n emoji. An emoji is a whole cluster: skin
+// tones, variation selectors, ZWJ sequences (👨‍💻), flags (🇮🇱 is two
+// regional indicators, 🏴󠁧󠁢󠁳󠁣󠁴󠁿 a base and tags) and keycaps (1️⃣) each count
+// once and are kept or dropped whole.
+func limitEmoji(reply string, n int) string {
+	runes := []rune(reply)
+	var b strings.Builder
+	count := 0
+	for i := 0; i < len(runes); {
+		end, emoji := nextCluster(runes, i)
+		if emoji {
+			count++
+		}
+		if !emoji || count <= n {
+			b.WriteString(string(runes[i:end]))
+		}
+		i = end
+	}
+	return spaceBeforePunct.ReplaceAllString(doubleSpace.ReplaceAllString(b.String(), " "), "$1")
+}
+
+// nextCluster returns where the character cluster starting at i ends, and
+// whether it is an emoji. Only emoji clusters span several runes.
+func nextCluster(runes []rune, i int) (end int, emoji bool) {
+	r := runes[i]
+	at := func(j int) rune {
+		if j < len(runes) {
+			return runes[j]
+		}
+		return 0
+	}
+	switch {
+	case isRegionalIndicator(r):
+		if isRegionalIndicator(at(i + 1)) {
+			return i + 2, true
+		}
+		return i + 1, true
+	case strings.ContainsRune("0123456789#*", r):
+		if at(i+1) == keycap {
+			return i + 2, true
+		}
+		if at(i+1) == '\uFE0F' && at(i+2) == keycap {
+			return i + 3, true
+		}
+		return i + 1, false
+	case !isEmoji(r):
+		return i + 1, false
+	}
+	j := i + 1
+	for j < len(runes) {
+		switch {
+		case isEmojiModifier(runes[j]):
+			j++
+		case runes[j] == '\u200D' && isEmoji(at(j+1)):
+			j += 2
+		default:
+			return j, true
+		}
+	}
+	return j, true
+}
+
+const keycap = '\u20E3'
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// isEmojiModifier reports whether r changes the emoji before it: variation
+// selector, skin tone, keycap or tag (subdivision flags)
+func isEmojiModifier(r rune) bool {
+	return r == '\uFE0F' || r == keycap || (r >= 0x1F3FB && r <= 0x1F3FF) || (r >= 0xE0020 && r <= 0xE007F)
+}
+
+func isEmoji(r rune) bool {
+	return (r >= 0x1F000 && r <= 0x1FAFF) || (r >= 0x2600 && r <= 0x27BF) ||
+		(r >= 0x2B00 && r <= 0x2BFF) || r == 0x2764 || r == 0x203C || r == 0x2049
+}
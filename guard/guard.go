@@ -0,0 +1,101 @@
+// Package guard post-processes LLM replies before they go out: checks in a
+// Chain either repair a reply (formatting) or reject it (character breaks,
+// leaked details), in which case the caller regenerates with the corrective
+// instructions and finally falls back to a canned line for the persona.
+package guard
+
+import (
+	"math/rand/v2"
+	"strings"
+)
+
+// Style is the active persona's output rules
+type Style struct {
+	Name         string   // Persona's name, as written in the system prompt
+	NoBold       bool     // Strip *bold* / **bold**
+	MaxEmoji     int      // 0 = no limit
+	MaxSentences int      // 0 = no limit
+	Lowercase    bool     // Texts in all lowercase
+	Fallbacks    []string // Canned in-character lines for when every attempt fails
+	BusyLines    []string // Canned "can't talk now" lines, for rate limits
+}
+
+// Fallback picks one of the persona's canned lines
+func (s Style) Fallback() string {
+	if len(s.Fallbacks) == 0 {
+		return "sorry, got distracted. what were we saying?"
+	}
+	return s.Fallbacks[rand.IntN(len(s.Fallbacks))]
+}
+
+// Busy picks one of the persona's "can't talk now" lines
+func (s Style) Busy() string {
+	if len(s.BusyLines) == 0 {
+		return "busy rn, talk later"
+	}
+	return s.BusyLines[rand.IntN(len(s.BusyLines))]
+}
+
+// Problem is a reason to reject a reply
+type Problem struct {
+	Check  string
+	Reason string // For logs
+	Fix    string // Corrective instruction for the next attempt
+}
+
+// Check inspects one reply. It may return a repaired reply, or a problem
+// if the reply can't be sent as is.
+type Check interface {
+	Name() string
+	Check(reply string) (string, *Problem)
+}
+
+// Chain runs checks in order. Repairs carry over to the next check; the
+// first problem stops the chain.
+type Chain struct {
+	Checks []Check
+}
+
+// NewChain is the standard order: reject what can't be fixed first, then
+// tidy the formatting. prompt is the protected part of the system prompt
+// the reply was generated from, canaries the tokens planted in it.
+func NewChain(style Style, prompt string, canaries map[string]string) *Chain {
+	return &Chain{Checks: []Check{
+		NewPromptLeak(prompt, canaries),
+		&CharacterBreak{Persona: style.Name},
+		&PIILeak{Prompt: prompt},
+		&Formatting{Style: style},
+	}}
+}
+
+// Run returns the (possibly repaired) reply, or the problem that rejected it
+func (c *Chain) Run(reply string) (string, *Problem) {
+	for _, check := range c.Checks {
+		var p *Problem
+		reply, p = check.Check(reply)
+		if p != nil {
+			p.Check = check.Name()
+			return reply, p
+		}
+	}
+	if strings.TrimSpace(reply) == "" {
+		return "", &Problem{Check: "empty", Reason: "nothing left after cleanup", Fix: "Reply with a short, normal message."}
+	}
+	return reply, nil
+}
+
+// Corrective turns rejected attempts into an instruction for the next one
+func Corrective(problems []*Problem) string {
+	var b strings.Builder
+	b.WriteString("Your previous reply was not sent because it broke the rules. Write a new reply.")
+	seen := map[string]bool{}
+	for _, p := range problems {
+		if seen[p.Fix] {
+			continue
+		}
+		seen[p.Fix] = true
+		b.WriteString(" ")
+		b.WriteString(p.Fix)
+	}
+	return b.String()
+}
@@ -0,0 +1,128 @@
+// Package history keeps each chat's transcript in the bot's SQL database, so
+// the persona picks the conversation up where it left off after a restart,
+// and several bots sharing one Postgres see the same chat. The bot still
+// works from the transcript in memory; this is its durable copy.
+package history
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"whatsapp-bot/migrate"
+)
+
+// Message is one turn of a chat
+type Message struct {
+	MsgID   string // WhatsApp message ID, empty if unknown
+	Speaker string // "me" or "them"
+	Text    string
+	At      time.Time
+	Lang    string // Language they wrote in, "" if unknown
+}
+
+// migrations of bot_history; append only
+var migrations = []migrate.Step{
+	{
+		SQLite: `CREATE TABLE bot_history (
+	id      INTEGER PRIMARY KEY,
+	chat    TEXT NOT NULL,
+	msg_id  TEXT NOT NULL DEFAULT '',
+	speaker TEXT NOT NULL,
+	text    TEXT NOT NULL,
+	at      BIGINT NOT NULL
+)`,
+		Postgres: `CREATE TABLE bot_history (
+	id      BIGSERIAL PRIMARY KEY,
+	chat    TEXT NOT NULL,
+	msg_id  TEXT NOT NULL DEFAULT '',
+	speaker TEXT NOT NULL,
+	text    TEXT NOT NULL,
+	at      BIGINT NOT NULL
+)`,
+	},
+	{SQLite: `CREATE INDEX bot_history_chat ON bot_history (chat, at)`},
+	{SQLite: `CREATE UNIQUE INDEX bot_history_msg ON bot_history (chat, msg_id) WHERE msg_id <> ''`},
+	{SQLite: `ALTER TABLE bot_history ADD COLUMN lang TEXT NOT NULL DEFAULT ''`},
+}
+
+// Store keeps the transcript of each chat
+type Store struct {
+	db *sql.DB
+
+	Keep int // Newest messages kept per chat; older ones are deleted
+}
+
+// Open creates or upgrades the history table
+func Open(ctx context.Context, db *sql.DB, dialect migrate.Dialect) (*Store, error) {
+	if err := migrate.Apply(ctx, db, dialect, "history", migrations); err != nil {
+		return nil, err
+	}
+	return &Store{db: db, Keep: 1000}, nil
+}
+
+// Append stores messages of a chat. A message whose ID is already stored
+// for the chat is skipped, so synced history can be appended again.
+func (s *Store) Append(ctx context.Context, chat string, msgs ...Message) error {
+	for _, m := range msgs {
+		_, err := s.db.ExecContext(ctx,
+			`INSERT INTO bot_history (chat, msg_id, speaker, text, at, lang) VALUES ($1, $2, $3, $4, $5, $6)
+			 ON CONFLICT (chat, msg_id) WHERE msg_id <> '' DO NOTHING`,
+			chat, m.MsgID, m.Speaker, m.Text, m.At.UnixMilli(), m.Lang)
+		if err != nil {
+			return fmt.Errorf("failed to store message: %w", err)
+		}
+	}
+	return s.prune(ctx, chat)
+}
+
+// prune drops a chat's messages beyond the newest Keep
+func (s *Store) prune(ctx context.Context, chat string) error {
+	if s.Keep <= 0 {
+		return nil
+	}
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM bot_history WHERE chat = $1 AND id NOT IN (
+			SELECT id FROM bot_history WHERE chat = $1 ORDER BY at DESC, id DESC LIMIT $2)`,
+		chat, s.Keep)
+	if err != nil {
+		return fmt.Errorf("failed to prune history: %w", err)
+	}
+	return nil
+}
+
+// Recent returns up to n of a chat's newest messages, oldest first
+func (s *Store) Recent(ctx context.Context, chat string, n int) ([]Message, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT msg_id, speaker, text, at, lang FROM bot_history WHERE chat = $1 ORDER BY at DESC, id DESC LIMIT $2`,
+		chat, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []Message
+	for rows.Next() {
+		var m Message
+		var at int64
+		if err := rows.Scan(&m.MsgID, &m.Speaker, &m.Text, &at, &m.Lang); err != nil {
+			return nil, err
+		}
+		m.At = time.UnixMilli(at)
+		msgs = append(msgs, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+	return msgs, nil
+}
+
+// Clear deletes a chat's transcript
+func (s *Store) Clear(ctx context.Context, chat string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM bot_history WHERE chat = $1`, chat)
+	return err
+}
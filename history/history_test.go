@@ -0,0 +1,90 @@
+package history
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"whatsapp-bot/migrate/migratetest"
+)
+
+func texts(msgs []Message) []string {
+	var out []string
+	for _, m := range msgs {
+		out = append(out, m.Text)
+	}
+	return out
+}
+
+func TestAppendAndRecent(t *testing.T) {
+	ctx := context.Background()
+	migratetest.Each(t, Open, func(t *testing.T, s *Store) {
+		now := time.Now()
+		chat := "972546371966@s.whatsapp.net"
+
+		err := s.Append(ctx, chat,
+			Message{MsgID: "A", Speaker: "them", Text: "hey", At: now.Add(-3 * time.Minute), Lang: "en"},
+			Message{MsgID: "B", Speaker: "me", Text: "hi!", At: now.Add(-2 * time.Minute)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Synced again, plus an older message that came later and one without an ID
+		err = s.Append(ctx, chat,
+			Message{MsgID: "A", Speaker: "them", Text: "hey", At: now.Add(-3 * time.Minute)},
+			Message{MsgID: "Z", Speaker: "them", Text: "earlier", At: now.Add(-time.Hour)},
+			Message{Speaker: "me", Text: "no id", At: now.Add(-time.Minute)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Append(ctx, "other@s.whatsapp.net", Message{MsgID: "A", Speaker: "them", Text: "elsewhere", At: now}); err != nil {
+			t.Fatal(err)
+		}
+
+		msgs, err := s.Recent(ctx, chat, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := texts(msgs), []string{"earlier", "hey", "hi!", "no id"}; !slices.Equal(got, want) {
+			t.Errorf("got %q, want %q", got, want)
+		}
+		if msgs[1].MsgID != "A" || msgs[1].Speaker != "them" || msgs[1].Lang != "en" || msgs[1].At.UnixMilli() != now.Add(-3*time.Minute).UnixMilli() {
+			t.Errorf("got %+v", msgs[1])
+		}
+
+		msgs, _ = s.Recent(ctx, chat, 2)
+		if got := texts(msgs); !slices.Equal(got, []string{"hi!", "no id"}) {
+			t.Errorf("newest 2: got %q", got)
+		}
+
+		if err := s.Clear(ctx, chat); err != nil {
+			t.Fatal(err)
+		}
+		if msgs, _ := s.Recent(ctx, chat, 10); len(msgs) != 0 {
+			t.Errorf("after Clear: got %q", texts(msgs))
+		}
+		if msgs, _ := s.Recent(ctx, "other@s.whatsapp.net", 10); len(msgs) != 1 {
+			t.Errorf("Clear touched another chat: got %q", texts(msgs))
+		}
+	})
+}
+
+func TestKeep(t *testing.T) {
+	ctx := context.Background()
+	migratetest.Each(t, Open, func(t *testing.T, s *Store) {
+		s.Keep = 3
+		now := time.Now()
+		for i, text := range []string{"1", "2", "3", "4", "5"} {
+			if err := s.Append(ctx, "c", Message{Speaker: "them", Text: text, At: now.Add(time.Duration(i) * time.Second)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		msgs, err := s.Recent(ctx, "c", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := texts(msgs); !slices.Equal(got, []string{"3", "4", "5"}) {
+			t.Errorf("got %q, want the newest 3", got)
+		}
+	})
+}
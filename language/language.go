@@ -0,0 +1,143 @@
+// Package language guesses what language a chat message is in and decides
+// which language the persona answers in. Detection is offline and cheap:
+// the writing system settles most languages, and common words tell the
+// Latin-script ones apart.
+package language
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Guess is what Detect makes of a message
+type Guess struct {
+	Lang       string   // ISO 639-1 code of the main language, "" if unsure
+	Confidence float64  // 0-1
+	Langs      []string // Every language seen, main first (for mixed messages)
+}
+
+var scripts = []struct {
+	lang  string
+	table *unicode.RangeTable
+}{
+	{"he", unicode.Hebrew}, {"ar", unicode.Arabic}, {"ru", unicode.Cyrillic}, {"el", unicode.Greek},
+	{"hi", unicode.Devanagari}, {"th", unicode.Thai}, {"ja", unicode.Hiragana}, {"ja", unicode.Katakana},
+	{"ko", unicode.Hangul}, {"zh", unicode.Han},
+}
+
+// commonWords tell Latin-script languages apart. Words shared by several of
+// them ("a", "no", "de") are left out.
+var commonWords = map[string][]string{
+	"en": {"the", "and", "you", "is", "are", "what", "how", "that", "this", "with", "have", "not", "just",
+		"it's", "i'm", "was", "will", "can", "your", "for", "my", "me", "we", "they", "but", "so", "yes", "yeah"},
+	"es": {"el", "los", "las", "que", "y", "es", "está", "estás", "pero", "por", "para", "con", "qué", "cómo",
+		"sí", "yo", "tú", "muy", "bien", "gracias", "hola", "también", "tengo", "eres"},
+	"fr": {"le", "les", "et", "est", "je", "tu", "vous", "pas", "mais", "pour", "avec", "oui", "très", "bien",
+		"merci", "bonjour", "c'est", "suis", "une", "des", "qui", "quoi"},
+	"de": {"der", "die", "das", "und", "ist", "ich", "du", "nicht", "aber", "mit", "für", "ja", "sehr", "gut",
+		"danke", "hallo", "auch", "ein", "eine", "bist", "wie", "was"},
+	"pt": {"os", "as", "que", "e", "é", "está", "você", "não", "mas", "por", "para", "com", "sim", "muito",
+		"bem", "obrigado", "obrigada", "olá", "também", "eu", "tudo"},
+	"it": {"il", "gli", "che", "e", "è", "sono", "io", "tu", "non", "ma", "per", "con", "sì", "molto", "bene",
+		"grazie", "ciao", "anche", "come", "cosa"},
+}
+
+var wordLangs = func() map[string][]string {
+	m := map[string][]string{}
+	for lang, words := range commonWords {
+		for _, w := range words {
+			m[w] = append(m[w], lang)
+		}
+	}
+	return m
+}()
+
+// Detect guesses the language of text. Very short messages ("ok", "😂")
+// come back unsure.
+func Detect(text string) Guess {
+	letters := map[string]int{}
+	total := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		total++
+		lang := "latin"
+		for _, s := range scripts {
+			if unicode.Is(s.table, r) {
+				lang = s.lang
+				break
+			}
+		}
+		letters[lang]++
+	}
+	if total < 3 {
+		return Guess{}
+	}
+	// Japanese uses kanji too: any kana makes Han Japanese
+	if letters["ja"] > 0 {
+		letters["ja"] += letters["zh"]
+		delete(letters, "zh")
+	}
+	if n := letters["latin"]; n > 0 {
+		delete(letters, "latin")
+		letters[latinLanguage(text)] += n // "" when no word gives it away
+	}
+
+	var g Guess
+	for first := true; len(letters) > 0; first = false {
+		best, found := "", false
+		for lang, n := range letters {
+			if !found || n > letters[best] || (n == letters[best] && lang < best) {
+				best, found = lang, true
+			}
+		}
+		share := float64(letters[best]) / float64(total)
+		if best != "" && share >= 0.15 {
+			g.Langs = append(g.Langs, best)
+		}
+		if first {
+			g.Lang, g.Confidence = best, share
+		}
+		delete(letters, best)
+	}
+	if g.Lang == "" || g.Confidence < 0.5 {
+		return Guess{Langs: g.Langs}
+	}
+	return g
+}
+
+// latinLanguage picks the Latin-script language with the most common words
+// in text, "" if there are none
+func latinLanguage(text string) string {
+	votes := map[string]float64{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		langs := wordLangs[w]
+		for _, l := range langs {
+			votes[l] += 1 / float64(len(langs))
+		}
+	}
+	best, bestVotes := "", 0.0
+	for l, v := range votes {
+		if v > bestVotes || (v == bestVotes && l < best) {
+			best, bestVotes = l, v
+		}
+	}
+	return best
+}
+
+var names = map[string]string{
+	"en": "English", "he": "Hebrew", "ar": "Arabic", "ru": "Russian", "el": "Greek", "hi": "Hindi",
+	"th": "Thai", "ja": "Japanese", "ko": "Korean", "zh": "Chinese", "es": "Spanish", "fr": "French",
+	"de": "German", "pt": "Portuguese", "it": "Italian",
+}
+
+// Name is the English name of a language code, the code itself if unknown
+func Name(lang string) string {
+	if n, ok := names[lang]; ok {
+		return n
+	}
+	return lang
+}
@@ -0,0 +1,63 @@
+package language
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	for _, c := range []struct {
+		text, lang string
+		langs      []string
+	}{
+		{"מה קורה? איך היה בעבודה", "he", []string{"he"}},
+		{"hey how are you doing", "en", []string{"en"}},
+		{"hola, cómo estás? todo bien", "es", []string{"es"}},
+		{"ich bin müde, und du?", "de", []string{"de"}},
+		{"שמעתי שהיה meeting ארוך היום", "he", []string{"he"}},
+		{"привет, как дела", "ru", []string{"ru"}},
+		{"ok", "", nil},
+		{"😂😂😂", "", nil},
+		{"lol", "", nil}, // Latin, but no telling words
+	} {
+		g := Detect(c.text)
+		if g.Lang != c.lang || !reflect.DeepEqual(g.Langs, c.langs) {
+			t.Errorf("Detect(%q) = %q %v, want %q %v", c.text, g.Lang, g.Langs, c.lang, c.langs)
+		}
+	}
+	// Half and half: both languages show up
+	if g := Detect("the meeting is tomorrow מחר בבוקר בשמונה"); len(g.Langs) != 2 {
+		t.Errorf("mixed message langs = %v", g.Langs)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	for _, c := range []struct {
+		spec, theirs, previous, want string
+	}{
+		{"", "he", "", "en"},
+		{"en", "he", "", "en"},
+		{"fixed:he", "en", "", "he"},
+		{"mirror", "he", "en", "he"},
+		{"mirror", "", "he", "he"},
+		{"mirror:en", "", "", "en"},
+		{"mirror", "", "", ""},
+		{"he+en", "en", "", "en"},
+		{"bilingual:he+en", "es", "", "he"},
+		{"he+en", "", "en", "en"},
+	} {
+		p, err := ParsePolicy(c.spec)
+		if err != nil {
+			t.Errorf("ParsePolicy(%q): %v", c.spec, err)
+			continue
+		}
+		if got := p.Choose(c.theirs, c.previous); got != c.want {
+			t.Errorf("%s.Choose(%q, %q) = %q, want %q", p, c.theirs, c.previous, got, c.want)
+		}
+	}
+	for _, bad := range []string{"klingon", "mirror:en+he", "fixed:en+he", "bilingual:en", "sometimes"} {
+		if _, err := ParsePolicy(bad); err == nil {
+			t.Errorf("ParsePolicy(%q) accepted", bad)
+		}
+	}
+}
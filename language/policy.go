@@ -0,0 +1,118 @@
+package language
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Mode is how a persona picks its reply language
+type Mode string
+
+const (
+	Mirror    Mode = "mirror"    // Whatever the target writes in
+	Fixed     Mode = "fixed"     // Always one language
+	Bilingual Mode = "bilingual" // The target's language if it's one of two, else the first
+)
+
+// Policy is a persona's reply language rule. Langs holds the fixed
+// language, the two bilingual ones, or Mirror's fallback for when the
+// target's language isn't known yet.
+type Policy struct {
+	Mode  Mode
+	Langs []string
+}
+
+// ParsePolicy reads "mirror", "mirror:en" (English until the target's
+// language is known), "en" or "fixed:en", and "he+en" or "bilingual:he+en".
+// Empty means "en".
+func ParsePolicy(spec string) (Policy, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "" {
+		return Policy{Mode: Fixed, Langs: []string{"en"}}, nil
+	}
+	mode, langs, explicit := strings.Cut(spec, ":")
+	if !explicit {
+		switch {
+		case spec == string(Mirror):
+			mode, langs = string(Mirror), ""
+		case strings.Contains(spec, "+"):
+			mode, langs = string(Bilingual), spec
+		default:
+			mode, langs = string(Fixed), spec
+		}
+	}
+
+	p := Policy{Mode: Mode(mode)}
+	if langs != "" {
+		for _, l := range strings.Split(langs, "+") {
+			l = strings.TrimSpace(l)
+			if _, ok := names[l]; !ok {
+				return Policy{}, fmt.Errorf("unknown language %q in %q (use codes like en, he, es)", l, spec)
+			}
+			p.Langs = append(p.Langs, l)
+		}
+	}
+	switch {
+	case p.Mode == Mirror && len(p.Langs) <= 1,
+		p.Mode == Fixed && len(p.Langs) == 1,
+		p.Mode == Bilingual && len(p.Langs) == 2:
+		return p, nil
+	}
+	return Policy{}, fmt.Errorf("invalid language policy %q (want mirror, mirror:en, en or he+en)", spec)
+}
+
+func (p Policy) String() string {
+	if len(p.Langs) == 0 {
+		return string(p.Mode)
+	}
+	return string(p.Mode) + ":" + strings.Join(p.Langs, "+")
+}
+
+// Choose picks the reply language. theirs is the language of what the
+// target just said ("" if unsure), previous the chat's last known one.
+func (p Policy) Choose(theirs, previous string) string {
+	if theirs == "" {
+		theirs = previous
+	}
+	switch p.Mode {
+	case Fixed:
+		return p.Langs[0]
+	case Bilingual:
+		if theirs == p.Langs[1] {
+			return theirs
+		}
+		return p.Langs[0]
+	}
+	if theirs == "" && len(p.Langs) > 0 {
+		return p.Langs[0]
+	}
+	return theirs
+}
+
+// Guidance tells the persona which language to reply in. theirs is the
+// language of what the target just said ("" if unsure).
+func (p Policy) Guidance(reply, theirs string) string {
+	if reply == "" {
+		return "LANGUAGE: Reply in the language they're writing in."
+	}
+	switch p.Mode {
+	case Fixed:
+		if theirs != "" && theirs != reply {
+			return fmt.Sprintf("LANGUAGE: Reply in %s only. They wrote in %s: you understand it, but you answer in %s.",
+				Name(reply), Name(theirs), Name(reply))
+		}
+		return fmt.Sprintf("LANGUAGE: Reply in %s only.", Name(reply))
+	case Bilingual:
+		return fmt.Sprintf("LANGUAGE: You text in both %s and %s. Reply in %s this time; dropping in a word of %s is fine.",
+			Name(p.Langs[0]), Name(p.Langs[1]), Name(reply), Name(p.other(reply)))
+	}
+	return fmt.Sprintf("LANGUAGE: They're writing in %s. Reply in natural, casual %s, the way a native speaker texts.",
+		Name(reply), Name(reply))
+}
+
+func (p Policy) other(lang string) string {
+	if p.Langs[0] == lang {
+		return p.Langs[1]
+	}
+	return p.Langs[0]
+}
@@ -0,0 +1,216 @@
+// Package length decides how long a reply should be. It looks at what the
+// target sent since the persona last spoke (how much, how many questions,
+// whether it's emotional), how long their messages usually are and how
+// wordy the persona is meant to be, and turns that into prompt guidance
+// plus a hard token limit for the model.
+package length
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Verbosity is how wordy a persona is by nature
+type Verbosity string
+
+const (
+	Terse  Verbosity = "terse"
+	Normal Verbosity = "normal"
+	Chatty Verbosity = "chatty"
+)
+
+// ParseVerbosity reads "terse", "normal" or "chatty". Empty means Normal.
+func ParseVerbosity(s string) (Verbosity, error) {
+	switch v := Verbosity(strings.ToLower(strings.TrimSpace(s))); v {
+	case "":
+		return Normal, nil
+	case Terse, Normal, Chatty:
+		return v, nil
+	}
+	return "", fmt.Errorf("invalid verbosity %q (want terse, normal or chatty)", s)
+}
+
+// Input is what the advice is based on
+type Input struct {
+	Burst        []string  // Their messages since the persona last spoke, oldest first
+	TheirAverage float64   // Words per message they usually send (0 = unknown)
+	Verbosity    Verbosity // The persona's
+	MaxSentences int       // The persona's hard limit (0 = none)
+	Deflect      bool      // Brushing off a suspicious message: always one line
+}
+
+// Advice is how long the reply should be
+type Advice struct {
+	Sentences int
+	Questions int  // Questions in the burst that want an answer
+	Emotional bool // The burst is about feelings, not logistics
+	MaxTokens int  // Hard limit for the model (num_predict)
+	Guidance  string
+}
+
+// Advise sizes the reply
+func Advise(in Input) Advice {
+	total := 0
+	for _, m := range in.Burst {
+		total += len(strings.Fields(m))
+	}
+	a := Advice{Questions: questions(in.Burst), Emotional: emotional(in.Burst)}
+
+	switch {
+	case total > 60:
+		a.Sentences = 4
+	case total > 30:
+		a.Sentences = 3
+	case total > 10:
+		a.Sentences = 2
+	default:
+		a.Sentences = 1
+	}
+	// Each question gets its own answer
+	a.Sentences = max(a.Sentences, min(a.Questions, 3))
+	if a.Emotional {
+		a.Sentences++
+	}
+	// Match their rhythm: someone who texts in fragments doesn't get essays
+	switch {
+	case in.TheirAverage > 0 && in.TheirAverage < 5 && !a.Emotional:
+		a.Sentences = min(a.Sentences, 2)
+	case in.TheirAverage > 20:
+		a.Sentences++
+	}
+	switch in.Verbosity {
+	case Terse:
+		a.Sentences--
+	case Chatty:
+		a.Sentences++
+	}
+	a.Sentences = max(1, min(a.Sentences, 5))
+	if in.MaxSentences > 0 {
+		a.Sentences = min(a.Sentences, in.MaxSentences)
+	}
+	if in.Deflect {
+		a.Sentences = 1
+	}
+
+	// Generous enough never to cut a sentence short (Hebrew takes more
+	// tokens per word), tight enough to stop a runaway monologue
+	a.MaxTokens = 40 + 40*a.Sentences
+	a.Guidance = a.describe(in.Deflect)
+	return a
+}
+
+func (a Advice) describe(deflect bool) string {
+	var parts []string
+	switch a.Sentences {
+	case 1:
+		parts = append(parts, "Keep it ultra brief. One short sentence.")
+	case 2:
+		parts = append(parts, "Keep it short. 1-2 sentences.")
+	default:
+		parts = append(parts, fmt.Sprintf("Moderate length. %d-%d sentences max.", a.Sentences-1, a.Sentences))
+	}
+	if deflect {
+		return parts[0]
+	}
+	switch {
+	case a.Questions == 1:
+		parts = append(parts, "They asked you something: answer it.")
+	case a.Questions > 1:
+		parts = append(parts, fmt.Sprintf("They asked %d things: answer each, briefly.", a.Questions))
+	}
+	if a.Emotional {
+		parts = append(parts, "They're sharing something that matters to them: acknowledge it warmly before anything else, don't brush it off.")
+	}
+	return strings.Join(parts, " ")
+}
+
+// questionWords start a short question even without a "?"
+var questionWords = map[string]bool{
+	"what": true, "why": true, "how": true, "when": true, "where": true, "who": true, "wanna": true,
+	"מה": true, "למה": true, "איך": true, "מתי": true, "איפה": true, "מי": true, "האם": true, "כמה": true,
+	"qué": true, "cómo": true, "cuándo": true, "dónde": true, "quién": true,
+}
+
+// questions counts the sentences of the burst that ask something
+func questions(burst []string) int {
+	n := 0
+	for _, m := range burst {
+		for _, s := range sentences(m) {
+			if strings.HasSuffix(s, "?") {
+				n++
+				continue
+			}
+			// "how was it" asks, "when I got home the dog..." tells
+			ws := words(s)
+			if len(ws) > 1 && len(ws) <= 6 && questionWords[ws[0]] && !strings.HasSuffix(s, ".") && !strings.HasSuffix(s, "!") {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// sentences splits a message after each ".", "!" or "?" run, and at line
+// breaks
+func sentences(m string) []string {
+	var out []string
+	start := 0
+	rs := []rune(m)
+	for i, r := range rs {
+		end := r == '\n'
+		if strings.ContainsRune(".!?", r) && (i+1 == len(rs) || !strings.ContainsRune(".!?", rs[i+1])) {
+			end = true
+		}
+		if end {
+			if s := strings.TrimSpace(string(rs[start : i+1])); s != "" {
+				out = append(out, s)
+			}
+			start = i + 1
+		}
+	}
+	if s := strings.TrimSpace(string(rs[start:])); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// feelings are words and emoji people use when something's weighing on
+// them, or when they're thrilled
+var feelings = []string{
+	"sad", "upset", "angry", "mad at", "hurt", "cry", "crying", "cried", "scared", "afraid", "worried",
+	"anxious", "stressed", "depressed", "lonely", "miss you", "love you", "heartbroken", "broke up",
+	"passed away", "died", "funeral", "hospital", "sick", "can't stop thinking", "so happy", "excited",
+	"proud of", "i'm sorry", "hate my",
+	"עצוב", "עצובה", "בוכה", "כועס", "כועסת", "פוחד", "פוחדת", "לחוץ", "לחוצה", "מתגעגע", "מתגעגעת",
+	"נפרדנו", "נפטר", "נפטרה", "בית חולים", "חולה", "מאושר", "מאושרת", "אוהב אותך", "אוהבת אותך", "סליחה",
+	"triste", "llorando", "te extraño", "preocupado", "preocupada", "enojado", "enojada",
+	"😢", "😭", "💔", "😞", "😔", "🥺", "😡", "❤️", "🥰",
+}
+
+// emotional reports whether the burst is about feelings
+func emotional(burst []string) bool {
+	text := strings.ToLower(strings.Join(burst, "\n"))
+	seen := map[string]bool{}
+	for _, w := range words(text) {
+		seen[w] = true
+	}
+	for _, f := range feelings {
+		// Single words must match whole: "sad" but not "crusade"
+		if len(words(f)) == 1 && words(f)[0] == f {
+			if seen[f] {
+				return true
+			}
+		} else if strings.Contains(text, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// words are the lowercase words of s, punctuation stripped
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+}
@@ -0,0 +1,225 @@
+// Package memory is the persona's long-term memory of a contact: durable
+// facts (partner's name, job, upcoming events, likes) the LLM extracts from
+// the chat now and then, kept in the bot's SQL database with when they were
+// learned and how sure the model was. The relevant ones go back into the
+// system prompt, so the persona remembers what fell out of the history
+// window or happened before a restart.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"whatsapp-bot/migrate"
+)
+
+// Category of a fact
+type Category string
+
+const (
+	Partner    Category = "partner"
+	Family     Category = "family"
+	Work       Category = "work" // Job or studies
+	Home       Category = "home" // Where they live, pets, housemates
+	Event      Category = "event"
+	Preference Category = "preference"
+	Other      Category = "other"
+)
+
+// ParseCategory maps the model's answer to a Category, Other if unknown
+func ParseCategory(s string) Category {
+	switch c := Category(strings.ToLower(strings.TrimSpace(s))); c {
+	case Partner, Family, Work, Home, Event, Preference:
+		return c
+	}
+	return Other
+}
+
+// Fact is one thing known about a contact
+type Fact struct {
+	ID         int64
+	Contact    string // chatKey of the contact
+	Category   Category
+	Text       string    // Short third-person sentence
+	Confidence float64   // 0-1; rises each time the fact is seen again
+	When       time.Time // Date of an event, zero if none
+	FirstSeen  time.Time
+	LastSeen   time.Time
+	Mentions   int
+}
+
+// migrations of bot_facts; append only
+var migrations = []migrate.Step{
+	{
+		SQLite: `CREATE TABLE bot_facts (
+	id         INTEGER PRIMARY KEY,
+	contact    TEXT NOT NULL,
+	category   TEXT NOT NULL,
+	fact       TEXT NOT NULL,
+	confidence DOUBLE PRECISION NOT NULL,
+	event_at   BIGINT NOT NULL DEFAULT 0,
+	first_seen BIGINT NOT NULL,
+	last_seen  BIGINT NOT NULL,
+	mentions   INTEGER NOT NULL DEFAULT 1
+)`,
+		Postgres: `CREATE TABLE bot_facts (
+	id         BIGSERIAL PRIMARY KEY,
+	contact    TEXT NOT NULL,
+	category   TEXT NOT NULL,
+	fact       TEXT NOT NULL,
+	confidence DOUBLE PRECISION NOT NULL,
+	event_at   BIGINT NOT NULL DEFAULT 0,
+	first_seen BIGINT NOT NULL,
+	last_seen  BIGINT NOT NULL,
+	mentions   INTEGER NOT NULL DEFAULT 1
+)`,
+	},
+	{SQLite: `CREATE INDEX bot_facts_contact ON bot_facts (contact, last_seen)`},
+}
+
+const columns = `id, contact, category, fact, confidence, event_at, first_seen, last_seen, mentions`
+
+// Store keeps facts per contact
+type Store struct {
+	db *sql.DB
+	mu sync.Mutex // Remember reads and writes a contact's facts together
+
+	MaxFacts int     // Per contact; the weakest are dropped beyond this
+	Similar  float64 // Word overlap at which two facts of a category are the same fact
+}
+
+// Open creates or upgrades the facts table
+func Open(ctx context.Context, db *sql.DB, dialect migrate.Dialect) (*Store, error) {
+	if err := migrate.Apply(ctx, db, dialect, "memory", migrations); err != nil {
+		return nil, err
+	}
+	return &Store{db: db, MaxFacts: 100, Similar: 0.6}, nil
+}
+
+// Facts returns everything known about a contact, most recently seen first
+func (s *Store) Facts(ctx context.Context, contact string) ([]Fact, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+columns+` FROM bot_facts WHERE contact = $1 ORDER BY last_seen DESC, id DESC`, contact)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var facts []Fact
+	for rows.Next() {
+		var f Fact
+		var category string
+		var when, first, last int64
+		if err := rows.Scan(&f.ID, &f.Contact, &category, &f.Text, &f.Confidence, &when, &first, &last, &f.Mentions); err != nil {
+			return nil, err
+		}
+		f.Category = Category(category)
+		if when != 0 {
+			f.When = time.UnixMilli(when)
+		}
+		f.FirstSeen, f.LastSeen = time.UnixMilli(first), time.UnixMilli(last)
+		facts = append(facts, f)
+	}
+	return facts, rows.Err()
+}
+
+// Remember merges newly extracted facts into a contact's memory. A fact
+// close enough to a known one of the same category replaces its wording
+// and raises its confidence; anything else is added. Returns how many were
+// added and updated.
+func (s *Store) Remember(ctx context.Context, contact string, found []Fact, now time.Time) (added, updated int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	known, err := s.Facts(ctx, contact)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, f := range found {
+		f.Text = strings.TrimSpace(f.Text)
+		if f.Text == "" {
+			continue
+		}
+		f.Confidence = min(max(f.Confidence, 0), 1)
+
+		if i := s.match(known, f); i >= 0 {
+			k := &known[i]
+			// Seen again: independent evidence, so the doubts multiply
+			k.Confidence = 1 - (1-k.Confidence)*(1-f.Confidence)
+			k.Text = f.Text
+			if !f.When.IsZero() {
+				k.When = f.When
+			}
+			k.LastSeen = now
+			k.Mentions++
+			_, err = s.db.ExecContext(ctx,
+				`UPDATE bot_facts SET fact = $1, confidence = $2, event_at = $3, last_seen = $4, mentions = $5 WHERE id = $6`,
+				k.Text, k.Confidence, unixMilli(k.When), now.UnixMilli(), k.Mentions, k.ID)
+			if err != nil {
+				return added, updated, fmt.Errorf("failed to update fact: %w", err)
+			}
+			updated++
+			continue
+		}
+
+		f.Contact, f.Category = contact, ParseCategory(string(f.Category))
+		f.FirstSeen, f.LastSeen, f.Mentions = now, now, 1
+		err = s.db.QueryRowContext(ctx,
+			`INSERT INTO bot_facts (contact, category, fact, confidence, event_at, first_seen, last_seen, mentions)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, 1) RETURNING id`,
+			contact, string(f.Category), f.Text, f.Confidence, unixMilli(f.When), now.UnixMilli(), now.UnixMilli()).Scan(&f.ID)
+		if err != nil {
+			return added, updated, fmt.Errorf("failed to store fact: %w", err)
+		}
+		known = append(known, f)
+		added++
+	}
+
+	return added, updated, s.prune(ctx, known, now)
+}
+
+// match finds the known fact f restates, -1 if none
+func (s *Store) match(known []Fact, f Fact) int {
+	best, bestScore := -1, s.Similar
+	for i, k := range known {
+		if k.Category != ParseCategory(string(f.Category)) {
+			continue
+		}
+		if score := overlap(words(k.Text), words(f.Text)); score >= bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// prune drops the weakest facts beyond MaxFacts
+func (s *Store) prune(ctx context.Context, known []Fact, now time.Time) error {
+	if s.MaxFacts <= 0 || len(known) <= s.MaxFacts {
+		return nil
+	}
+	sort.Slice(known, func(i, j int) bool { return weight(known[i], now) > weight(known[j], now) })
+	for _, f := range known[s.MaxFacts:] {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM bot_facts WHERE id = $1`, f.ID); err != nil {
+			return fmt.Errorf("failed to prune facts: %w", err)
+		}
+	}
+	return nil
+}
+
+// Forget deletes everything known about a contact
+func (s *Store) Forget(ctx context.Context, contact string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM bot_facts WHERE contact = $1`, contact)
+	return err
+}
+
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
@@ -0,0 +1,109 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"whatsapp-bot/migrate/migratetest"
+)
+
+func TestRememberMergesRestatedFacts(t *testing.T) {
+	ctx := context.Background()
+	migratetest.Each(t, Open, func(t *testing.T, s *Store) {
+		day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+		added, updated, err := s.Remember(ctx, "chat", []Fact{
+			{Category: Partner, Text: "Her girlfriend is Dana", Confidence: 0.6},
+			{Category: Work, Text: "Works as a nurse at the city hospital", Confidence: 0.9},
+		}, day)
+		if err != nil || added != 2 || updated != 0 {
+			t.Fatalf("first: added %d updated %d, %v", added, updated, err)
+		}
+
+		added, updated, err = s.Remember(ctx, "chat", []Fact{
+			{Category: Partner, Text: "Her girlfriend Dana", Confidence: 0.5},
+			{Category: "pets", Text: "Has a cat called Miso", Confidence: 0.8},
+		}, day.Add(time.Hour))
+		if err != nil || added != 1 || updated != 1 {
+			t.Fatalf("second: added %d updated %d, %v", added, updated, err)
+		}
+
+		facts, err := s.Facts(ctx, "chat")
+		if err != nil || len(facts) != 3 {
+			t.Fatalf("facts = %+v, %v", facts, err)
+		}
+		for _, f := range facts {
+			switch f.Category {
+			case Partner:
+				if f.Mentions != 2 || f.Confidence < 0.79 || f.Confidence > 0.81 || !f.FirstSeen.Equal(day) {
+					t.Errorf("restated fact not merged: %+v", f)
+				}
+			case Other:
+				if f.Text != "Has a cat called Miso" {
+					t.Errorf("unknown category not mapped to other: %+v", f)
+				}
+			}
+		}
+		if other, _ := s.Facts(ctx, "someone else"); len(other) != 0 {
+			t.Errorf("facts leaked to another contact: %+v", other)
+		}
+	})
+}
+
+func TestRememberKeepsStrongest(t *testing.T) {
+	ctx := context.Background()
+	migratetest.Each(t, Open, func(t *testing.T, s *Store) {
+		s.MaxFacts = 2
+		now := time.Now()
+		_, _, err := s.Remember(ctx, "chat", []Fact{
+			{Category: Preference, Text: "Loves spicy ramen", Confidence: 0.9},
+			{Category: Preference, Text: "Maybe into jazz", Confidence: 0.3},
+			{Category: Home, Text: "Lives in Lisbon", Confidence: 0.8},
+		}, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		facts, _ := s.Facts(ctx, "chat")
+		if len(facts) != 2 {
+			t.Fatalf("kept %d facts, want 2", len(facts))
+		}
+		for _, f := range facts {
+			if f.Text == "Maybe into jazz" {
+				t.Errorf("weakest fact kept: %+v", facts)
+			}
+		}
+	})
+}
+
+func TestParseFacts(t *testing.T) {
+	raw := `Sure! {"facts": [
+		{"category": "Event", "fact": "Has a job interview", "confidence": 0.8, "date": "2026-03-04"},
+		{"category": "work", "fact": "", "confidence": 0.9},
+		{"category": "home", "fact": "Might move to Porto", "confidence": 0.2}
+	]}`
+	facts, err := parseFacts(raw, 0.4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(facts) != 1 || facts[0].Category != Event || facts[0].When.Format("2006-01-02") != "2026-03-04" {
+		t.Errorf("facts = %+v", facts)
+	}
+	if _, err := parseFacts("no idea", 0); err == nil {
+		t.Error("answer without JSON accepted")
+	}
+}
+
+func TestRelevantSkipsPastEventsAndFavoursTopic(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	facts := []Fact{
+		{Text: "Had a dentist appointment", Confidence: 1, When: now.AddDate(0, 0, -5), LastSeen: now},
+		{Text: "Loves hiking in the mountains", Confidence: 0.6, LastSeen: now},
+		{Text: "Works as a nurse", Confidence: 0.9, LastSeen: now},
+		{Text: "Sister is called Ana", Confidence: 0.9, LastSeen: now.AddDate(-1, 0, 0)},
+	}
+	got := Relevant(facts, "going hiking this weekend?", 2, now)
+	if len(got) != 2 || got[0].Text != "Loves hiking in the mountains" || got[1].Text != "Works as a nurse" {
+		t.Errorf("relevant = %+v", got)
+	}
+}
@@ -0,0 +1,117 @@
+// Package migrate versions the bot's own tables, which live in the same
+// database as whatsmeow's session store: SQLite by default, or Postgres for
+// shared deployments. Each component (the outbox, ...) keeps an ordered list
+// of steps; the versions applied are recorded per component in
+// bot_migrations, so a step runs exactly once per database.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Dialect is the SQL flavour of the database, named like whatsmeow's
+// sqlstore dialects (and the database/sql driver names)
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite3"
+	Postgres Dialect = "postgres"
+)
+
+// ParseDialect accepts "sqlite3" or "postgres" and the usual aliases; empty
+// means SQLite
+func ParseDialect(s string) (Dialect, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "sqlite", "sqlite3":
+		return SQLite, nil
+	case "postgres", "postgresql", "pgx":
+		return Postgres, nil
+	}
+	return "", fmt.Errorf("unknown database dialect %q (want sqlite3 or postgres)", s)
+}
+
+// Step is one schema change. Postgres falls back to SQLite when empty, since
+// most DDL is the same on both.
+type Step struct {
+	SQLite   string
+	Postgres string
+}
+
+func (s Step) sql(d Dialect) string {
+	if d == Postgres && s.Postgres != "" {
+		return s.Postgres
+	}
+	return s.SQLite
+}
+
+const schema = `CREATE TABLE IF NOT EXISTS bot_migrations (
+	component  TEXT NOT NULL,
+	version    INTEGER NOT NULL,
+	applied_at BIGINT NOT NULL,
+	PRIMARY KEY (component, version)
+)`
+
+// Apply runs the component's steps that haven't run yet, each in its own
+// transaction. Step i (0-based) is version i+1; never reorder or edit steps
+// that have shipped, only append.
+func Apply(ctx context.Context, db *sql.DB, d Dialect, component string, steps []Step) error {
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("failed to create bot_migrations: %w", err)
+	}
+	for i, step := range steps {
+		version := i + 1
+		if err := apply(ctx, db, d, component, version, step); err != nil {
+			return fmt.Errorf("%s migration %d: %w", component, version, err)
+		}
+	}
+	return nil
+}
+
+func apply(ctx context.Context, db *sql.DB, d Dialect, component string, version int, step Step) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Several bots may share one Postgres: only one migrates at a time
+	if d == Postgres {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('bot_migrations'))`); err != nil {
+			return err
+		}
+	}
+
+	var done int
+	err = tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM bot_migrations WHERE component = $1 AND version = $2`,
+		component, version).Scan(&done)
+	if err != nil {
+		return err
+	}
+	if done > 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, step.sql(d)); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO bot_migrations (component, version, applied_at) VALUES ($1, $2, $3)`,
+		component, version, time.Now().UnixMilli())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Version returns the last applied version of a component, 0 if none
+func Version(ctx context.Context, db *sql.DB, component string) (int, error) {
+	var v sql.NullInt64
+	err := db.QueryRowContext(ctx,
+		`SELECT MAX(version) FROM bot_migrations WHERE component = $1`, component).Scan(&v)
+	return int(v.Int64), err
+}
@@ -0,0 +1,97 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"whatsapp-bot/migrate"
+	"whatsapp-bot/migrate/migratetest"
+	"whatsapp-bot/outbox"
+)
+
+func TestApplyRunsEachStepOnce(t *testing.T) {
+	ctx := context.Background()
+	steps := []migrate.Step{
+		{
+			SQLite:   `CREATE TABLE migrate_test (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`,
+			Postgres: `CREATE TABLE migrate_test (id BIGSERIAL PRIMARY KEY, name TEXT NOT NULL)`,
+		},
+		{SQLite: `ALTER TABLE migrate_test ADD COLUMN note TEXT NOT NULL DEFAULT ''`},
+	}
+	migratetest.Run(t, func(t *testing.T, db *sql.DB, dialect migrate.Dialect) {
+		if err := migrate.Apply(ctx, db, dialect, "test", steps[:1]); err != nil {
+			t.Fatal(err)
+		}
+		// Re-running applied steps would fail: CREATE TABLE without IF NOT EXISTS
+		if err := migrate.Apply(ctx, db, dialect, "test", steps); err != nil {
+			t.Fatal(err)
+		}
+		if err := migrate.Apply(ctx, db, dialect, "test", steps); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := migrate.Version(ctx, db, "test"); err != nil || v != 2 {
+			t.Errorf("version = %d, %v; want 2", v, err)
+		}
+		if v, _ := migrate.Version(ctx, db, "other"); v != 0 {
+			t.Errorf("untouched component version = %d, want 0", v)
+		}
+
+		var id int64
+		err := db.QueryRow(`INSERT INTO migrate_test (name, note) VALUES ($1, $2) RETURNING id`, "a", "b").Scan(&id)
+		if err != nil || id != 1 {
+			t.Errorf("insert after migrations: id %d, %v", id, err)
+		}
+	})
+}
+
+func TestApplyRollsBackFailedStep(t *testing.T) {
+	ctx := context.Background()
+	migratetest.Run(t, func(t *testing.T, db *sql.DB, dialect migrate.Dialect) {
+		bad := []migrate.Step{{SQLite: `CREATE TABLE`}}
+		if err := migrate.Apply(ctx, db, dialect, "broken", bad); err == nil {
+			t.Fatal("invalid step applied")
+		}
+		if v, _ := migrate.Version(ctx, db, "broken"); v != 0 {
+			t.Errorf("failed step recorded as version %d", v)
+		}
+	})
+}
+
+// The outbox is the bot's table that differs most between backends
+// (autoincrement ids), so run it through a send on each
+func TestOutboxOnEachBackend(t *testing.T) {
+	ctx := context.Background()
+	migratetest.Run(t, func(t *testing.T, db *sql.DB, dialect migrate.Dialect) {
+		q, err := outbox.New(ctx, db, dialect, func(context.Context, outbox.Message) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Opening again finds everything migrated
+		if _, err := outbox.New(ctx, db, dialect, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		first, err := q.Enqueue(ctx, outbox.Message{Chat: "a", Text: "hi", MsgID: "m1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := q.Enqueue(ctx, outbox.Message{Chat: "a", Text: "there", MsgID: "m2"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if second.ID <= first.ID {
+			t.Errorf("ids not increasing: %d then %d", first.ID, second.ID)
+		}
+		if _, err := q.Enqueue(ctx, outbox.Message{Chat: "a", Text: "there", MsgID: "m2"}); err != outbox.ErrDuplicate {
+			t.Errorf("duplicate message ID: got %v, want ErrDuplicate", err)
+		}
+		if _, err := q.Enqueue(ctx, outbox.Message{Chat: "a", Text: "hi", MsgID: "m3"}); err != nil {
+			t.Errorf("same text, new ID: %v", err)
+		}
+		pending, err := q.Pending(ctx)
+		if err != nil || len(pending) != 3 || pending[0].MsgID != "m1" {
+			t.Errorf("pending = %+v, %v", pending, err)
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package mood
+
+import (
+	"strings"
+	"unicode"
+)
+
+// cue is how much a word or emoji says about someone's state
+type cue struct {
+	valence float64 // -1 to 1
+	stress  float64 // 0 to 1
+}
+
+// lexicon holds single words and emoji. Word forms are listed as written;
+// Hebrew words carry no niqqud.
+var lexicon = map[string]cue{
+	// English
+	"happy": {0.7, 0}, "glad": {0.6, 0}, "great": {0.6, 0}, "amazing": {0.8, 0}, "awesome": {0.7, 0},
+	"love": {0.6, 0}, "loved": {0.6, 0}, "excited": {0.7, 0.1}, "yay": {0.7, 0}, "fun": {0.5, 0},
+	"relieved": {0.5, 0}, "proud": {0.6, 0}, "lol": {0.3, 0}, "haha": {0.4, 0}, "hahaha": {0.5, 0},
+	"nice": {0.4, 0}, "good": {0.3, 0}, "best": {0.5, 0}, "thanks": {0.3, 0}, "perfect": {0.6, 0},
+	"sad": {-0.7, 0.1}, "upset": {-0.7, 0.3}, "angry": {-0.7, 0.5}, "mad": {-0.5, 0.4}, "furious": {-0.9, 0.6},
+	"hurt": {-0.6, 0.2}, "crying": {-0.8, 0.4}, "cried": {-0.7, 0.3}, "cry": {-0.6, 0.3},
+	"lonely": {-0.6, 0.1}, "depressed": {-0.9, 0.3}, "miserable": {-0.9, 0.3}, "awful": {-0.7, 0.2},
+	"terrible": {-0.7, 0.2}, "horrible": {-0.7, 0.2}, "bad": {-0.4, 0.1}, "worst": {-0.7, 0.2},
+	"hate": {-0.6, 0.3}, "sucks": {-0.5, 0.1}, "tired": {-0.3, 0.2}, "exhausted": {-0.5, 0.4},
+	"stressed": {-0.5, 0.8}, "stress": {-0.4, 0.7}, "stressful": {-0.4, 0.7}, "anxious": {-0.5, 0.8},
+	"anxiety": {-0.5, 0.8}, "worried": {-0.4, 0.7}, "nervous": {-0.3, 0.7}, "panic": {-0.6, 0.9},
+	"overwhelmed": {-0.5, 0.9}, "deadline": {-0.1, 0.5}, "scared": {-0.6, 0.7}, "afraid": {-0.5, 0.6},
+	"sick": {-0.5, 0.3}, "hospital": {-0.6, 0.6}, "funeral": {-0.8, 0.3}, "died": {-0.9, 0.4},
+	"fired": {-0.7, 0.6}, "broke": {-0.3, 0.3}, "ugh": {-0.4, 0.3}, "sorry": {-0.2, 0.1},
+	"fml": {-0.6, 0.5}, "wtf": {-0.3, 0.5},
+
+	// Hebrew
+	"שמח": {0.7, 0}, "שמחה": {0.7, 0}, "מאושר": {0.8, 0}, "מאושרת": {0.8, 0}, "מעולה": {0.6, 0},
+	"מדהים": {0.8, 0}, "אחלה": {0.5, 0}, "כיף": {0.6, 0}, "אוהב": {0.5, 0}, "אוהבת": {0.5, 0},
+	"מתרגש": {0.6, 0.2}, "מתרגשת": {0.6, 0.2}, "סבבה": {0.3, 0}, "תודה": {0.3, 0}, "חחח": {0.4, 0},
+	"חחחח": {0.5, 0}, "יאיי": {0.7, 0}, "גאה": {0.6, 0},
+	"עצוב": {-0.7, 0.1}, "עצובה": {-0.7, 0.1}, "בוכה": {-0.8, 0.4}, "בכיתי": {-0.7, 0.3},
+	"כועס": {-0.7, 0.5}, "כועסת": {-0.7, 0.5}, "עצבני": {-0.6, 0.6}, "עצבנית": {-0.6, 0.6},
+	"מבואס": {-0.6, 0.2}, "מבואסת": {-0.6, 0.2}, "בודד": {-0.6, 0.1}, "בודדה": {-0.6, 0.1},
+	"גרוע": {-0.6, 0.2}, "נורא": {-0.5, 0.3}, "שונא": {-0.6, 0.3}, "שונאת": {-0.6, 0.3},
+	"עייף": {-0.3, 0.2}, "עייפה": {-0.3, 0.2}, "גמור": {-0.5, 0.4}, "גמורה": {-0.5, 0.4},
+	"לחוץ": {-0.5, 0.8}, "לחוצה": {-0.5, 0.8}, "לחץ": {-0.4, 0.7}, "מלחיץ": {-0.4, 0.7},
+	"דואג": {-0.4, 0.7}, "דואגת": {-0.4, 0.7}, "מפחד": {-0.6, 0.7}, "מפחדת": {-0.6, 0.7},
+	"פוחד": {-0.6, 0.7}, "פוחדת": {-0.6, 0.7}, "חולה": {-0.5, 0.3}, "נפטר": {-0.9, 0.4},
+	"נפטרה": {-0.9, 0.4}, "פוטרתי": {-0.7, 0.6}, "אוף": {-0.4, 0.3}, "סליחה": {-0.2, 0.1},
+
+	// Spanish
+	"feliz": {0.7, 0}, "genial": {0.6, 0}, "contento": {0.6, 0}, "contenta": {0.6, 0},
+	"jaja": {0.4, 0}, "jajaja": {0.5, 0}, "gracias": {0.3, 0},
+	"triste": {-0.7, 0.1}, "llorando": {-0.8, 0.4}, "enojado": {-0.7, 0.5}, "enojada": {-0.7, 0.5},
+	"estresado": {-0.5, 0.8}, "estresada": {-0.5, 0.8}, "preocupado": {-0.4, 0.7}, "preocupada": {-0.4, 0.7},
+	"cansado": {-0.3, 0.2}, "cansada": {-0.3, 0.2},
+
+	// Emoji
+	"😀": {0.6, 0}, "😃": {0.6, 0}, "😄": {0.7, 0}, "😁": {0.6, 0}, "😂": {0.5, 0}, "🤣": {0.5, 0},
+	"😊": {0.6, 0}, "🥰": {0.7, 0}, "😍": {0.7, 0}, "❤": {0.5, 0}, "🎉": {0.7, 0}, "🥳": {0.7, 0},
+	"👍": {0.3, 0}, "🙏": {0.2, 0},
+	"😢": {-0.7, 0.2}, "😭": {-0.7, 0.4}, "💔": {-0.8, 0.2}, "😞": {-0.6, 0.1}, "😔": {-0.6, 0.1},
+	"☹": {-0.5, 0.1}, "🙁": {-0.4, 0.1}, "😡": {-0.7, 0.6}, "😤": {-0.5, 0.5}, "😩": {-0.5, 0.6},
+	"😫": {-0.5, 0.6}, "😰": {-0.5, 0.8}, "😱": {-0.4, 0.8}, "🥺": {-0.3, 0.2}, "😬": {-0.2, 0.5},
+}
+
+// negations flip the next cue within three words
+var negations = map[string]bool{
+	"not": true, "no": true, "never": true, "don't": true, "isn't": true, "wasn't": true, "ain't": true,
+	"לא": true, "אין": true, "בלי": true,
+	"nunca": true,
+}
+
+// intensifiers strengthen the next cue
+var intensifiers = map[string]bool{
+	"so": true, "very": true, "really": true, "super": true, "extremely": true, "too": true,
+	"ממש": true, "מאוד": true, "כזה": true,
+	"muy": true,
+}
+
+// Analyze reads the tone of one message
+func Analyze(text string) Reading {
+	var r Reading
+	negated, boost := 0, 1.0
+	for _, tok := range tokens(strings.ToLower(text)) {
+		if negations[tok] {
+			negated = 3
+			continue
+		}
+		c, ok := lexicon[tok]
+		if !ok {
+			if intensifiers[tok] {
+				boost = 1.5
+				continue
+			}
+			boost = 1
+			if negated > 0 {
+				negated--
+			}
+			continue
+		}
+		v := c.valence * boost
+		if negated > 0 {
+			// "not happy" is bad, "not bad" only mildly good
+			v = -v / 2
+		}
+		r.Valence += v
+		r.Stress += c.stress * boost
+		r.Cues++
+		negated, boost = 0, 1
+	}
+	if r.Cues == 0 {
+		return Reading{}
+	}
+	r.Valence /= float64(r.Cues)
+	r.Stress /= float64(r.Cues)
+	// Shouting sounds frantic
+	if strings.Contains(text, "!!!") || strings.Contains(text, "???") {
+		r.Stress += 0.2
+	}
+	r.Valence = max(-1, min(r.Valence, 1))
+	r.Stress = max(0, min(r.Stress, 1))
+	return r
+}
+
+// tokens splits text into words and single emoji
+func tokens(text string) []string {
+	var out []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			out = append(out, string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || r == '\'':
+			word = append(word, r)
+		case r == '\uFE0F' || (r >= 0x1F3FB && r <= 0x1F3FF):
+			// Emoji variation selector and skin tones
+		case r > 0x2000 && (unicode.Is(unicode.So, r) || unicode.Is(unicode.Sk, r)):
+			flush()
+			out = append(out, string(r))
+		default:
+			flush()
+		}
+	}
+	flush()
+	return out
+}
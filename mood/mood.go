@@ -0,0 +1,207 @@
+// Package mood reads the emotional tone of the target's messages and keeps
+// a timeline of it per contact. Each message is scored offline with a small
+// English, Hebrew and Spanish lexicon (plus emoji), negation and
+// intensifiers included. The recent readings add up to a mood ("stressed",
+// "upset", "happy"...) that the prompt and the admin status show.
+package mood
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"whatsapp-bot/migrate"
+)
+
+// Reading is the tone of one message
+type Reading struct {
+	Valence float64 // -1 (miserable) to 1 (delighted)
+	Stress  float64 // 0 (calm) to 1 (frantic)
+	Cues    int     // Words and emoji that gave it away; 0 means neutral
+}
+
+// Mood is how a contact seems lately
+type Mood struct {
+	Label    string // Stressed, Upset, Down, Happy or Neutral
+	Valence  float64
+	Stress   float64
+	Messages int // Readings with cues it's based on
+}
+
+const (
+	Stressed = "stressed"
+	Upset    = "upset"
+	Down     = "down"
+	Happy    = "happy"
+	Neutral  = "neutral"
+)
+
+// Troubled reports whether the contact seems to be having a hard time, when
+// jokes would land badly
+func (m Mood) Troubled() bool {
+	return m.Label == Stressed || m.Label == Upset || m.Label == Down
+}
+
+// Day is one day of a contact's timeline
+type Day struct {
+	Date     string // YYYY-MM-DD, local time
+	Valence  float64
+	Stress   float64
+	Messages int // Readings with cues
+}
+
+// migrations of bot_mood; append only
+var migrations = []migrate.Step{
+	{
+		SQLite: `CREATE TABLE bot_mood (
+	contact TEXT NOT NULL,
+	msg_id  TEXT NOT NULL,
+	valence DOUBLE PRECISION NOT NULL,
+	stress  DOUBLE PRECISION NOT NULL,
+	cues    INTEGER NOT NULL,
+	sent_at BIGINT NOT NULL,
+	PRIMARY KEY (contact, msg_id)
+)`,
+	},
+	{SQLite: `CREATE INDEX bot_mood_recent ON bot_mood (contact, sent_at)`},
+}
+
+// Store keeps every contact's readings
+type Store struct {
+	db *sql.DB
+
+	Window   time.Duration // How far back the current mood looks
+	HalfLife time.Duration // Within the window, older readings count less
+}
+
+// Open creates or upgrades the mood table
+func Open(ctx context.Context, db *sql.DB, dialect migrate.Dialect) (*Store, error) {
+	if err := migrate.Apply(ctx, db, dialect, "mood", migrations); err != nil {
+		return nil, err
+	}
+	return &Store{db: db, Window: 24 * time.Hour, HalfLife: 6 * time.Hour}, nil
+}
+
+// Add records the reading of a message. A message recorded before is kept
+// as it was.
+func (s *Store) Add(ctx context.Context, contact, msgID string, r Reading, at time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO bot_mood (contact, msg_id, valence, stress, cues, sent_at) VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (contact, msg_id) DO NOTHING`,
+		contact, msgID, r.Valence, r.Stress, r.Cues, at.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to store mood: %w", err)
+	}
+	return nil
+}
+
+// Current is the contact's mood over the last Window
+func (s *Store) Current(ctx context.Context, contact string, now time.Time) (Mood, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT valence, stress, sent_at FROM bot_mood WHERE contact = $1 AND cues > 0 AND sent_at >= $2`,
+		contact, now.Add(-s.Window).UnixMilli())
+	if err != nil {
+		return Mood{}, err
+	}
+	defer rows.Close()
+
+	var m Mood
+	var weights float64
+	for rows.Next() {
+		var valence, stress float64
+		var at int64
+		if err := rows.Scan(&valence, &stress, &at); err != nil {
+			return Mood{}, err
+		}
+		age := now.Sub(time.UnixMilli(at))
+		w := math.Pow(0.5, max(age, 0).Hours()/s.HalfLife.Hours())
+		m.Valence += w * valence
+		m.Stress += w * stress
+		weights += w
+		m.Messages++
+	}
+	if err := rows.Err(); err != nil {
+		return Mood{}, err
+	}
+	if weights > 0 {
+		m.Valence /= weights
+		m.Stress /= weights
+	}
+	m.Label = label(m)
+	return m, nil
+}
+
+// label names a mood. One stray message isn't a mood unless it's strong.
+func label(m Mood) string {
+	strong := m.Messages >= 2 || math.Abs(m.Valence) >= 0.6 || m.Stress >= 0.6
+	switch {
+	case m.Messages == 0 || !strong:
+		return Neutral
+	case m.Stress >= 0.4 && m.Valence < 0.2:
+		return Stressed
+	case m.Valence <= -0.35:
+		return Upset
+	case m.Valence <= -0.15:
+		return Down
+	case m.Valence >= 0.35:
+		return Happy
+	}
+	return Neutral
+}
+
+// Timeline is the contact's mood per day for the last n days, oldest first.
+// Days without readings are left out.
+func (s *Store) Timeline(ctx context.Context, contact string, n int, now time.Time) ([]Day, error) {
+	y, mo, d := now.Date()
+	since := time.Date(y, mo, d-n+1, 0, 0, 0, 0, now.Location())
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT valence, stress, sent_at FROM bot_mood WHERE contact = $1 AND cues > 0 AND sent_at >= $2 ORDER BY sent_at`,
+		contact, since.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []Day
+	for rows.Next() {
+		var valence, stress float64
+		var at int64
+		if err := rows.Scan(&valence, &stress, &at); err != nil {
+			return nil, err
+		}
+		date := time.UnixMilli(at).In(now.Location()).Format("2006-01-02")
+		if len(days) == 0 || days[len(days)-1].Date != date {
+			days = append(days, Day{Date: date})
+		}
+		day := &days[len(days)-1]
+		day.Valence += valence
+		day.Stress += stress
+		day.Messages++
+	}
+	for i := range days {
+		days[i].Valence /= float64(days[i].Messages)
+		days[i].Stress /= float64(days[i].Messages)
+	}
+	return days, rows.Err()
+}
+
+// Prompt is the mood section of the system prompt, "" if they seem fine
+func Prompt(name string, m Mood) string {
+	var line string
+	switch m.Label {
+	case Stressed:
+		line = fmt.Sprintf("%s seems stressed today. Be easygoing and supportive, don't pile on.", name)
+	case Upset:
+		line = fmt.Sprintf("%s seems upset today. Be kind and take them seriously.", name)
+	case Down:
+		line = fmt.Sprintf("%s seems a bit down today. Be warm.", name)
+	case Happy:
+		line = fmt.Sprintf("%s seems in a great mood today. Match their energy.", name)
+	default:
+		return ""
+	}
+	return fmt.Sprintf("\n\nTHEIR MOOD (from %d recent message(s); don't mention that you noticed unless they bring it up): %s",
+		m.Messages, line)
+}
@@ -0,0 +1,95 @@
+package mood
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"whatsapp-bot/migrate/migratetest"
+)
+
+func TestAnalyze(t *testing.T) {
+	for _, c := range []struct {
+		text     string
+		negative bool
+		positive bool
+		stressed bool
+	}{
+		{"omg I got the job!! so happy 🎉", false, true, false},
+		{"I'm so stressed about the exam tomorrow, I can't sleep", true, false, true},
+		{"not happy with how today went", true, false, false},
+		{"אני ממש עצובה היום", true, false, false},
+		{"לחוץ מטורף מהמבחן 😰", true, false, true},
+		{"estoy muy triste", true, false, false},
+		{"the train leaves at 8", false, false, false},
+		{"hahaha 😂", false, true, false},
+	} {
+		r := Analyze(c.text)
+		if (r.Valence < -0.15) != c.negative || (r.Valence > 0.15) != c.positive || (r.Stress >= 0.4) != c.stressed {
+			t.Errorf("Analyze(%q) = %+v", c.text, r)
+		}
+	}
+	if r := Analyze("the train leaves at 8"); r.Cues != 0 {
+		t.Errorf("neutral text has cues: %+v", r)
+	}
+	// Negation softens and flips
+	if r := Analyze("not bad"); r.Valence <= 0 || r.Valence > 0.3 {
+		t.Errorf("not bad = %+v", r)
+	}
+}
+
+func TestCurrentAndTimeline(t *testing.T) {
+	ctx := context.Background()
+	migratetest.Each(t, Open, func(t *testing.T, s *Store) {
+		now := time.Date(2025, 6, 10, 18, 0, 0, 0, time.UTC)
+
+		// Happy two days ago, stressed today
+		for i, m := range []struct {
+			text string
+			at   time.Time
+		}{
+			{"great day at the beach 😄", now.Add(-50 * time.Hour)},
+			{"haha amazing", now.Add(-49 * time.Hour)},
+			{"ugh so stressed, deadline tomorrow", now.Add(-3 * time.Hour)},
+			{"I'm worried I won't make it 😰", now.Add(-2 * time.Hour)},
+			{"ok", now.Add(-1 * time.Hour)},
+		} {
+			if err := s.Add(ctx, "chat", string(rune('a'+i)), Analyze(m.text), m.at); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Recorded twice, counted once
+		s.Add(ctx, "chat", "c", Analyze("ugh so stressed, deadline tomorrow"), now.Add(-3*time.Hour))
+
+		m, err := s.Current(ctx, "chat", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Label != Stressed || m.Messages != 2 || !m.Troubled() {
+			t.Errorf("current = %+v", m)
+		}
+		if p := Prompt("Noa", m); p == "" {
+			t.Error("no prompt for a stressed contact")
+		}
+		if other, _ := s.Current(ctx, "other", now); other.Label != Neutral || Prompt("Dan", other) != "" {
+			t.Errorf("unknown contact = %+v", other)
+		}
+
+		days, err := s.Timeline(ctx, "chat", 7, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(days) != 2 || days[0].Date != "2025-06-08" || days[0].Valence <= 0 || days[1].Valence >= 0 || days[1].Messages != 2 {
+			t.Errorf("timeline = %+v", days)
+		}
+	})
+}
+
+func TestOneMildMessageIsNoMood(t *testing.T) {
+	if l := label(Mood{Valence: -0.3, Messages: 1}); l != Neutral {
+		t.Errorf("one mild message = %s", l)
+	}
+	if l := label(Mood{Valence: -0.8, Messages: 1}); l != Upset {
+		t.Errorf("one strong message = %s", l)
+	}
+}
@@ -0,0 +1,335 @@
+// Package outbox is a durable queue of outgoing WhatsApp messages, kept in
+// the bot's SQL database. Messages are sent oldest-first per chat, retried
+// with exponential backoff while sending fails, and survive restarts, so
+// replies generated while offline go out after reconnecting.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"whatsapp-bot/migrate"
+)
+
+// Status of a queued message
+type Status string
+
+const (
+	Pending Status = "pending"
+	Sent    Status = "sent"
+	Failed  Status = "failed" // Gave up, or the error was permanent
+)
+
+// Message is one queued message
+type Message struct {
+	ID        int64
+	Chat      string // chatKey of the recipient
+	Text      string
+	MsgID     string // WhatsApp message ID, fixed up front so a resend after a crash is the same message
+	Source    string // What queued it ("reply", "draft", "draft_timeout", "busy", "admin"), for the sender and logs
+	Key       string // What the message answers, e.g. "<incoming ID>:reply"; "" if nothing. Free again once the message failed.
+	Status    Status
+	Attempts  int
+	NextAt    time.Time
+	CreatedAt time.Time
+	LastError string
+}
+
+// Sender delivers one message. Errors are retried unless wrapped with
+// Permanent; Later holds the message without counting an attempt.
+type Sender func(ctx context.Context, m Message) error
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a send error that retrying won't fix
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+type laterError struct{ wait time.Duration }
+
+func (e laterError) Error() string { return fmt.Sprintf("not before %s", e.wait) }
+
+// Later tells the queue the message can't go out for another wait (a rate
+// limit, say). It keeps its place at the head of its chat and the attempt
+// isn't counted.
+func Later(wait time.Duration) error {
+	return laterError{wait}
+}
+
+// ErrDuplicate is returned by Enqueue for a message ID, or a chat's key,
+// that is already queued or sent
+var ErrDuplicate = errors.New("duplicate message")
+
+// migrations of bot_outbox; append only. Version 1 tolerates tables created
+// before migrations were tracked.
+var migrations = []migrate.Step{
+	{
+		SQLite: `CREATE TABLE IF NOT EXISTS bot_outbox (
+	id         INTEGER PRIMARY KEY,
+	chat       TEXT NOT NULL,
+	text       TEXT NOT NULL,
+	msg_id     TEXT NOT NULL UNIQUE,
+	source     TEXT NOT NULL DEFAULT '',
+	status     TEXT NOT NULL DEFAULT 'pending',
+	attempts   INTEGER NOT NULL DEFAULT 0,
+	next_at    BIGINT NOT NULL,
+	created_at BIGINT NOT NULL,
+	last_error TEXT NOT NULL DEFAULT ''
+)`,
+		Postgres: `CREATE TABLE IF NOT EXISTS bot_outbox (
+	id         BIGSERIAL PRIMARY KEY,
+	chat       TEXT NOT NULL,
+	text       TEXT NOT NULL,
+	msg_id     TEXT NOT NULL UNIQUE,
+	source     TEXT NOT NULL DEFAULT '',
+	status     TEXT NOT NULL DEFAULT 'pending',
+	attempts   INTEGER NOT NULL DEFAULT 0,
+	next_at    BIGINT NOT NULL,
+	created_at BIGINT NOT NULL,
+	last_error TEXT NOT NULL DEFAULT ''
+)`,
+	},
+	{SQLite: `CREATE INDEX IF NOT EXISTS bot_outbox_pending ON bot_outbox (status, chat, id)`},
+	{SQLite: `ALTER TABLE bot_outbox ADD COLUMN dedup_key TEXT NOT NULL DEFAULT ''`},
+	{SQLite: `CREATE UNIQUE INDEX bot_outbox_key ON bot_outbox (chat, dedup_key) WHERE dedup_key <> '' AND status <> 'failed'`},
+}
+
+const columns = `id, chat, text, msg_id, source, dedup_key, status, attempts, next_at, created_at, last_error`
+
+// Queue sends queued messages from a single worker (Run)
+type Queue struct {
+	db   *sql.DB
+	send Sender
+
+	BaseDelay   time.Duration // First retry delay, doubled per attempt
+	MaxDelay    time.Duration // Backoff cap
+	MaxAttempts int           // Then the message is marked failed
+	KeepFor     time.Duration // Sent/failed rows are pruned after this
+
+	OnSent   func(Message) // Called after a successful send
+	OnFailed func(Message) // Called when a message is given up on
+
+	wake chan struct{}
+}
+
+// New creates or upgrades the outbox table. Call Run to start sending.
+func New(ctx context.Context, db *sql.DB, dialect migrate.Dialect, send Sender) (*Queue, error) {
+	if err := migrate.Apply(ctx, db, dialect, "outbox", migrations); err != nil {
+		return nil, err
+	}
+	return &Queue{
+		db:          db,
+		send:        send,
+		BaseDelay:   2 * time.Second,
+		MaxDelay:    5 * time.Minute,
+		MaxAttempts: 12,
+		KeepFor:     7 * 24 * time.Hour,
+		wake:        make(chan struct{}, 1),
+	}, nil
+}
+
+// Enqueue adds a message. Chat, Text and MsgID are required; NextAt
+// defaults to now. MsgID and Key are idempotency keys: enqueueing either
+// twice returns ErrDuplicate, so a reply generated again for the same
+// incoming message isn't sent twice. The same text under a new ID and key
+// ("haha" twice) is sent again.
+func (q *Queue) Enqueue(ctx context.Context, m Message) (Message, error) {
+	now := time.Now()
+	if m.NextAt.IsZero() {
+		m.NextAt = now
+	}
+	m.CreatedAt, m.Status = now, Pending
+
+	err := q.db.QueryRowContext(ctx,
+		`INSERT INTO bot_outbox (chat, text, msg_id, source, dedup_key, status, attempts, next_at, created_at, last_error)
+		 VALUES ($1, $2, $3, $4, $5, 'pending', 0, $6, $7, '') ON CONFLICT DO NOTHING RETURNING id`,
+		m.Chat, m.Text, m.MsgID, m.Source, m.Key, m.NextAt.UnixMilli(), m.CreatedAt.UnixMilli()).Scan(&m.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return m, ErrDuplicate
+	}
+	if err != nil {
+		return m, err
+	}
+	q.Wake()
+	return m, nil
+}
+
+// Wake makes the worker look at the queue now, e.g. after reconnecting
+func (q *Queue) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Pending lists unsent messages, oldest first
+func (q *Queue) Pending(ctx context.Context) ([]Message, error) {
+	return q.query(ctx, `SELECT `+columns+` FROM bot_outbox WHERE status = 'pending' ORDER BY id`)
+}
+
+// Sent reports whether a WhatsApp message ID went out through the queue
+// (or was tried and given up on), as long as its row is kept (KeepFor)
+func (q *Queue) Sent(ctx context.Context, msgID string) (bool, error) {
+	var n int
+	err := q.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM bot_outbox WHERE msg_id = $1 AND status != 'pending'`, msgID).Scan(&n)
+	return n > 0, err
+}
+
+// heads returns the oldest pending message of every chat. Only a chat's
+// head is ever sent, which keeps each chat in order even while the head is
+// backing off.
+func (q *Queue) heads(ctx context.Context) ([]Message, error) {
+	return q.query(ctx, `SELECT `+columns+` FROM bot_outbox WHERE id IN (
+		SELECT MIN(id) FROM bot_outbox WHERE status = 'pending' GROUP BY chat
+	) ORDER BY next_at`)
+}
+
+func (q *Queue) query(ctx context.Context, query string, args ...any) ([]Message, error) {
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Message
+	for rows.Next() {
+		var m Message
+		var status string
+		var nextAt, createdAt int64
+		if err := rows.Scan(&m.ID, &m.Chat, &m.Text, &m.MsgID, &m.Source, &m.Key, &status, &m.Attempts, &nextAt, &createdAt, &m.LastError); err != nil {
+			return nil, err
+		}
+		m.Status = Status(status)
+		m.NextAt, m.CreatedAt = time.UnixMilli(nextAt), time.UnixMilli(createdAt)
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// Run sends messages until ctx is cancelled
+func (q *Queue) Run(ctx context.Context) {
+	var lastPrune time.Time
+	for {
+		if time.Since(lastPrune) > time.Hour {
+			q.prune(ctx)
+			lastPrune = time.Now()
+		}
+
+		wait := q.sendDue(ctx)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-q.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// sendDue sends every chat head that is due, returns how long until the
+// next one is
+func (q *Queue) sendDue(ctx context.Context) time.Duration {
+	const idle = time.Minute
+	heads, err := q.heads(ctx)
+	if err != nil {
+		fmt.Printf("⚠️  Outbox read failed: %v\n", err)
+		return 10 * time.Second
+	}
+	wait := idle
+	for _, m := range heads {
+		if until := time.Until(m.NextAt); until > 0 {
+			wait = min(wait, until)
+			continue
+		}
+		if next := q.attempt(ctx, m); next > 0 {
+			wait = min(wait, next)
+		} else {
+			wait = 0 // The chat's next message may be waiting behind this one
+		}
+	}
+	return wait
+}
+
+// attempt sends one message and records the outcome. Returns the retry
+// delay, or 0 if the message is done with.
+func (q *Queue) attempt(ctx context.Context, m Message) time.Duration {
+	sendCtx, cancel := context.WithTimeout(ctx, 90*time.Second)
+	err := q.send(sendCtx, m)
+	cancel()
+
+	var later laterError
+	if errors.As(err, &later) {
+		m.NextAt = time.Now().Add(later.wait)
+		q.update(ctx, m)
+		return max(later.wait, time.Millisecond)
+	}
+	m.Attempts++
+
+	if err == nil {
+		m.Status = Sent
+		q.update(ctx, m)
+		if q.OnSent != nil {
+			q.OnSent(m)
+		}
+		return 0
+	}
+
+	m.LastError = err.Error()
+	if IsPermanent(err) || m.Attempts >= q.MaxAttempts {
+		m.Status = Failed
+		q.update(ctx, m)
+		fmt.Printf("❌ Outbox gave up on message %d after %d attempt(s): %v\n", m.ID, m.Attempts, err)
+		if q.OnFailed != nil {
+			q.OnFailed(m)
+		}
+		return 0
+	}
+
+	delay := q.backoff(m.Attempts)
+	m.NextAt = time.Now().Add(delay)
+	q.update(ctx, m)
+	fmt.Printf("🔁 Send failed (attempt %d/%d), retrying in %s: %v\n", m.Attempts, q.MaxAttempts, delay.Round(time.Second), err)
+	return delay
+}
+
+// backoff doubles BaseDelay per attempt up to MaxDelay, with ±20% jitter
+func (q *Queue) backoff(attempts int) time.Duration {
+	d := q.BaseDelay << min(attempts-1, 20)
+	if d <= 0 || d > q.MaxDelay {
+		d = q.MaxDelay
+	}
+	return time.Duration(float64(d) * (0.8 + 0.4*rand.Float64()))
+}
+
+func (q *Queue) update(ctx context.Context, m Message) {
+	_, err := q.db.ExecContext(ctx,
+		`UPDATE bot_outbox SET status = $1, attempts = $2, next_at = $3, last_error = $4 WHERE id = $5`,
+		string(m.Status), m.Attempts, m.NextAt.UnixMilli(), m.LastError, m.ID)
+	if err != nil {
+		fmt.Printf("⚠️  Outbox update failed for message %d: %v\n", m.ID, err)
+	}
+}
+
+func (q *Queue) prune(ctx context.Context) {
+	_, err := q.db.ExecContext(ctx, `DELETE FROM bot_outbox WHERE status != 'pending' AND created_at < $1`,
+		time.Now().Add(-q.KeepFor).UnixMilli())
+	if err != nil {
+		fmt.Printf("⚠️  Outbox prune failed: %v\n", err)
+	}
+}
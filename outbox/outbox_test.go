@@ -0,0 +1,149 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"whatsapp-bot/migrate"
+	"whatsapp-bot/migrate/migratetest"
+)
+
+// openQueue opens queues that send with send, for migratetest.Each
+func openQueue(send Sender) func(context.Context, *sql.DB, migrate.Dialect) (*Queue, error) {
+	return func(ctx context.Context, db *sql.DB, dialect migrate.Dialect) (*Queue, error) {
+		return New(ctx, db, dialect, send)
+	}
+}
+
+func TestAttempt(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range []struct {
+		name     string
+		err      error
+		status   Status
+		attempts int
+		retry    bool
+	}{
+		{"sent", nil, Sent, 1, false},
+		{"retried", errors.New("timeout"), Pending, 1, true},
+		{"permanent", Permanent(errors.New("refused")), Failed, 1, false},
+		{"later", Later(time.Minute), Pending, 0, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			migratetest.Each(t, openQueue(func(context.Context, Message) error { return c.err }), func(t *testing.T, q *Queue) {
+				m, err := q.Enqueue(ctx, Message{Chat: "a", Text: "haha", MsgID: "m1"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				wait := q.attempt(ctx, m)
+				if (wait > 0) != c.retry {
+					t.Errorf("retry in %s, want retry %v", wait, c.retry)
+				}
+				got, err := q.query(ctx, `SELECT `+columns+` FROM bot_outbox`)
+				if err != nil || len(got) != 1 {
+					t.Fatalf("rows = %+v, %v", got, err)
+				}
+				if got[0].Status != c.status || got[0].Attempts != c.attempts {
+					t.Errorf("status %s after %d attempt(s), want %s after %d", got[0].Status, got[0].Attempts, c.status, c.attempts)
+				}
+			})
+		})
+	}
+}
+
+// A reply generated again for the same incoming message isn't queued twice,
+// unless the first one failed
+func TestEnqueueDuplicate(t *testing.T) {
+	ctx := context.Background()
+	send := func(context.Context, Message) error { return Permanent(errors.New("refused")) }
+	migratetest.Each(t, openQueue(send), func(t *testing.T, q *Queue) {
+		reply := Message{Chat: "a", Text: "haha", MsgID: "m1", Source: "reply", Key: "in1:reply"}
+		m, err := q.Enqueue(ctx, reply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := q.Enqueue(ctx, reply); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("same message ID: got %v, want ErrDuplicate", err)
+		}
+		retried := reply
+		retried.MsgID, retried.Text = "m2", "lol"
+		if _, err := q.Enqueue(ctx, retried); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("same key: got %v, want ErrDuplicate", err)
+		}
+		for _, other := range []Message{
+			{Chat: "b", Text: "haha", MsgID: "m3", Key: "in1:reply"},
+			{Chat: "a", Text: "haha", MsgID: "m4", Key: "in2:reply"},
+			{Chat: "a", Text: "haha", MsgID: "m5"},
+			{Chat: "a", Text: "haha", MsgID: "m6"},
+		} {
+			if _, err := q.Enqueue(ctx, other); err != nil {
+				t.Errorf("%+v: %v", other, err)
+			}
+		}
+
+		q.attempt(ctx, m)
+		retried.MsgID = "m7"
+		if _, err := q.Enqueue(ctx, retried); err != nil {
+			t.Errorf("after the first failed: %v", err)
+		}
+	})
+}
+
+// A rate-limited head holds back the rest of its chat, but not other chats
+func TestLaterKeepsOrder(t *testing.T) {
+	ctx := context.Background()
+	var sent []string
+	send := func(_ context.Context, m Message) error {
+		if m.Chat == "a" {
+			return Later(time.Hour)
+		}
+		sent = append(sent, m.MsgID)
+		return nil
+	}
+	migratetest.Each(t, openQueue(send), func(t *testing.T, q *Queue) {
+		sent = nil
+		for _, m := range []Message{
+			{Chat: "a", Text: "ok", MsgID: "a1"},
+			{Chat: "a", Text: "ok", MsgID: "a2"},
+			{Chat: "b", Text: "ok", MsgID: "b1"},
+		} {
+			if _, err := q.Enqueue(ctx, m); err != nil {
+				t.Fatal(err)
+			}
+		}
+		q.sendDue(ctx)
+		if wait := q.sendDue(ctx); wait < 30*time.Second {
+			t.Errorf("next look at the queue in %s, want it to idle while a waits", wait)
+		}
+		if len(sent) != 1 || sent[0] != "b1" {
+			t.Errorf("sent %v, want [b1]", sent)
+		}
+		pending, _ := q.Pending(ctx)
+		if len(pending) != 2 || pending[0].MsgID != "a1" || pending[0].Attempts != 0 {
+			t.Errorf("pending = %+v", pending)
+		}
+	})
+}
+
+func TestSent(t *testing.T) {
+	ctx := context.Background()
+	migratetest.Each(t, openQueue(func(context.Context, Message) error { return nil }), func(t *testing.T, q *Queue) {
+		m, err := q.Enqueue(ctx, Message{Chat: "a", Text: "haha", MsgID: "m1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sent, err := q.Sent(ctx, "m1"); err != nil || sent {
+			t.Errorf("queued: got %v, %v; want not sent yet", sent, err)
+		}
+		q.attempt(ctx, m)
+		if sent, err := q.Sent(ctx, "m1"); err != nil || !sent {
+			t.Errorf("after sending: got %v, %v; want sent", sent, err)
+		}
+		if sent, err := q.Sent(ctx, "yours"); err != nil || sent {
+			t.Errorf("unknown ID: got %v, %v; want not sent", sent, err)
+		}
+	})
+}
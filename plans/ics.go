@@ -0,0 +1,83 @@
+package plans
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ICS renders dated plans as an iCalendar file (RFC 5545) that calendar
+// apps can import or subscribe to. name turns a contact into the name the
+// events mention. Declined and undated plans are left out.
+func ICS(list []Plan, name func(contact string) string, now time.Time) []byte {
+	var b strings.Builder
+	line := func(s string) { b.WriteString(fold(s) + "\r\n") }
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//whatsapp-bot//plans//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:WhatsApp plans")
+	for _, p := range list {
+		if p.Start.IsZero() || p.Status == Declined {
+			continue
+		}
+		with := name(p.Contact)
+		line("BEGIN:VEVENT")
+		line(fmt.Sprintf("UID:plan-%d@whatsapp-bot", p.ID))
+		line("DTSTAMP:" + p.Updated.UTC().Format("20060102T150405Z"))
+		if p.AllDay {
+			line("DTSTART;VALUE=DATE:" + p.Start.Format("20060102"))
+			line("DTEND;VALUE=DATE:" + p.Start.AddDate(0, 0, 1).Format("20060102"))
+		} else {
+			line("DTSTART:" + p.Start.UTC().Format("20060102T150405Z"))
+			line("DTEND:" + p.Start.Add(time.Hour).UTC().Format("20060102T150405Z"))
+		}
+		line("SUMMARY:" + escape(fmt.Sprintf("%s with %s", p.What, with)))
+		if p.Where != "" {
+			line("LOCATION:" + escape(p.Where))
+		}
+		proposer := with
+		if p.ProposedBy == "me" {
+			proposer = "you (the bot)"
+		}
+		line("DESCRIPTION:" + escape(fmt.Sprintf("Suggested by %s on WhatsApp, %s.", proposer, p.Status)))
+		switch p.Status {
+		case Agreed:
+			line("STATUS:CONFIRMED")
+		case Cancelled:
+			line("STATUS:CANCELLED")
+		default:
+			line("STATUS:TENTATIVE")
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return []byte(b.String())
+}
+
+// escape quotes text values: backslashes, commas, semicolons and newlines
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// fold breaks lines longer than 75 bytes, never inside a character
+func fold(s string) string {
+	if len(s) <= 75 {
+		return s
+	}
+	var b strings.Builder
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		limit = 74 // Continuation lines start with a space
+	}
+	b.WriteString(s)
+	return b.String()
+}
@@ -0,0 +1,305 @@
+// Package plans keeps track of the plans made in each chat: "drinks
+// Thursday?" from the target, the persona's "sure, 8pm", a movie suggested
+// and never answered. The local model picks them out of the chat
+// (Extractor), Store keeps them, Prompt reminds the persona what it already
+// agreed to, and ICS exports them as an iCalendar file.
+package plans
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"whatsapp-bot/migrate"
+)
+
+// Status is where a plan stands
+type Status string
+
+const (
+	Proposed  Status = "proposed" // Suggested, not answered yet
+	Agreed    Status = "agreed"
+	Declined  Status = "declined"
+	Cancelled Status = "cancelled" // Agreed, then called off
+)
+
+// ParseStatus reads a status, Proposed if unknown
+func ParseStatus(s string) Status {
+	switch st := Status(strings.ToLower(strings.TrimSpace(s))); st {
+	case Agreed, Declined, Cancelled:
+		return st
+	}
+	return Proposed
+}
+
+// Plan is one commitment between the persona and the target
+type Plan struct {
+	ID         int64
+	Contact    string
+	What       string    // "drinks", "dinner at mom's"
+	Where      string    // "" if not said
+	Start      time.Time // Zero until a date is set
+	AllDay     bool      // The date is set, the time isn't
+	ProposedBy string    // "them" or "me"
+	Status     Status
+	Created    time.Time
+	Updated    time.Time
+}
+
+// When describes the plan's date and time for people
+func (p Plan) When() string {
+	switch {
+	case p.Start.IsZero():
+		return "no date yet"
+	case p.AllDay:
+		return p.Start.Format("Mon 2 Jan")
+	}
+	return p.Start.Format("Mon 2 Jan 15:04")
+}
+
+// migrations of bot_plans; append only
+var migrations = []migrate.Step{
+	{
+		SQLite: `CREATE TABLE bot_plans (
+	id          INTEGER PRIMARY KEY,
+	contact     TEXT NOT NULL,
+	what        TEXT NOT NULL,
+	place       TEXT NOT NULL DEFAULT '',
+	starts_at   BIGINT NOT NULL DEFAULT 0,
+	all_day     BOOLEAN NOT NULL DEFAULT FALSE,
+	proposed_by TEXT NOT NULL,
+	status      TEXT NOT NULL,
+	created_at  BIGINT NOT NULL,
+	updated_at  BIGINT NOT NULL
+)`,
+		Postgres: `CREATE TABLE bot_plans (
+	id          BIGSERIAL PRIMARY KEY,
+	contact     TEXT NOT NULL,
+	what        TEXT NOT NULL,
+	place       TEXT NOT NULL DEFAULT '',
+	starts_at   BIGINT NOT NULL DEFAULT 0,
+	all_day     BOOLEAN NOT NULL DEFAULT FALSE,
+	proposed_by TEXT NOT NULL,
+	status      TEXT NOT NULL,
+	created_at  BIGINT NOT NULL,
+	updated_at  BIGINT NOT NULL
+)`,
+	},
+	{SQLite: `CREATE INDEX bot_plans_contact ON bot_plans (contact, starts_at)`},
+}
+
+// Store keeps every contact's plans
+type Store struct {
+	db *sql.DB
+
+	Undated time.Duration // How long a plan without a date stays upcoming
+	Grace   time.Duration // How long after it starts a plan still shows
+}
+
+// Open creates or upgrades the plans table
+func Open(ctx context.Context, db *sql.DB, dialect migrate.Dialect) (*Store, error) {
+	if err := migrate.Apply(ctx, db, dialect, "plans", migrations); err != nil {
+		return nil, err
+	}
+	return &Store{db: db, Undated: 14 * 24 * time.Hour, Grace: 3 * time.Hour}, nil
+}
+
+const planColumns = `id, contact, what, place, starts_at, all_day, proposed_by, status, created_at, updated_at`
+
+// Upcoming returns the contact's plans still ahead (or undated and recent),
+// soonest first, undated last. Declined plans are left out.
+func (s *Store) Upcoming(ctx context.Context, contact string, now time.Time) ([]Plan, error) {
+	return s.query(ctx,
+		`SELECT `+planColumns+` FROM bot_plans WHERE contact = $1 AND status <> $2
+		 AND (starts_at >= $3 OR (starts_at = 0 AND updated_at >= $4))`,
+		contact, string(Declined), now.Add(-s.Grace).UnixMilli(), now.Add(-s.Undated).UnixMilli())
+}
+
+// Since returns every contact's dated plans starting after t, for export
+func (s *Store) Since(ctx context.Context, t time.Time) ([]Plan, error) {
+	return s.query(ctx,
+		`SELECT `+planColumns+` FROM bot_plans WHERE starts_at >= $1 AND status <> $2`,
+		t.UnixMilli(), string(Declined))
+}
+
+func (s *Store) query(ctx context.Context, query string, args ...any) ([]Plan, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Plan
+	for rows.Next() {
+		var p Plan
+		var start, created, updated int64
+		var status string
+		if err := rows.Scan(&p.ID, &p.Contact, &p.What, &p.Where, &start, &p.AllDay, &p.ProposedBy, &status, &created, &updated); err != nil {
+			return nil, err
+		}
+		if start != 0 {
+			p.Start = time.UnixMilli(start)
+		}
+		p.Status = Status(status)
+		p.Created, p.Updated = time.UnixMilli(created), time.UnixMilli(updated)
+		out = append(out, p)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i].Start, out[j].Start
+		if a.IsZero() != b.IsZero() {
+			return b.IsZero()
+		}
+		return a.Before(b)
+	})
+	return out, rows.Err()
+}
+
+// Record saves what the extractor found. A plan that matches an upcoming
+// one (by ID, or by what and when) updates it; anything else is added.
+// Returns the plans that are now Agreed and weren't before.
+func (s *Store) Record(ctx context.Context, contact string, found []Found, now time.Time) (agreed []Found, err error) {
+	known, err := s.Upcoming(ctx, contact, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, fd := range found {
+		f := fd.Plan
+		f.Contact = contact
+		old, ok := match(known, f)
+		if !ok {
+			err = s.db.QueryRowContext(ctx,
+				`INSERT INTO bot_plans (contact, what, place, starts_at, all_day, proposed_by, status, created_at, updated_at)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8) RETURNING id`,
+				contact, f.What, f.Where, unixOrZero(f.Start), f.AllDay, f.ProposedBy, string(f.Status), now.UnixMilli()).Scan(&f.ID)
+			if err != nil {
+				return agreed, fmt.Errorf("failed to store plan: %w", err)
+			}
+			f.Created, f.Updated = now, now
+			known = append(known, f)
+			if f.Status == Agreed {
+				agreed = append(agreed, Found{f, fd.InReply})
+			}
+			continue
+		}
+
+		merged := old
+		merged.Status = f.Status
+		if f.Where != "" {
+			merged.Where = f.Where
+		}
+		// A time beats a bare date, and a later message may move the plan
+		if !f.Start.IsZero() && (old.Start.IsZero() || !f.AllDay || old.AllDay) {
+			merged.Start, merged.AllDay = f.Start, f.AllDay
+		}
+		if merged == old {
+			continue
+		}
+		merged.Updated = now
+		_, err = s.db.ExecContext(ctx,
+			`UPDATE bot_plans SET place = $1, starts_at = $2, all_day = $3, status = $4, updated_at = $5 WHERE id = $6`,
+			merged.Where, unixOrZero(merged.Start), merged.AllDay, string(merged.Status), now.UnixMilli(), old.ID)
+		if err != nil {
+			return agreed, fmt.Errorf("failed to update plan: %w", err)
+		}
+		for i := range known {
+			if known[i].ID == old.ID {
+				known[i] = merged
+			}
+		}
+		if merged.Status == Agreed && old.Status != Agreed {
+			agreed = append(agreed, Found{merged, fd.InReply})
+		}
+	}
+	return agreed, nil
+}
+
+// match finds the known plan f is about: the same ID, or the same kind of
+// thing on the same day (or with no day on either side)
+func match(known []Plan, f Plan) (Plan, bool) {
+	for _, k := range known {
+		if f.ID != 0 && k.ID == f.ID {
+			return k, true
+		}
+	}
+	for _, k := range known {
+		sameDay := f.Start.IsZero() || k.Start.IsZero() || sameDate(f.Start, k.Start)
+		if sameDay && overlap(words(f.What), words(k.What)) {
+			return k, true
+		}
+	}
+	return Plan{}, false
+}
+
+func sameDate(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.In(a.Location()).Date()
+	return ay == by && am == bm && ad == bd
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// overlap reports whether two descriptions share a word
+func overlap(a, b []string) bool {
+	for _, w := range a {
+		for _, v := range b {
+			if w == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stopWords don't tell plans apart
+var stopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "at": true, "in": true, "on": true, "with": true, "to": true,
+	"for": true, "and": true, "of": true, "some": true, "go": true, "get": true, "grab": true,
+}
+
+// words are the meaningful lowercase words of a description
+func words(s string) []string {
+	var out []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !stopWords[w] {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// Prompt is the plans section of the system prompt, "" if there are none
+func Prompt(name string, list []Plan) string {
+	if len(list) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n\nPLANS WITH %s (stay consistent: don't forget what you agreed to, don't double-book, don't invent new details):", strings.ToUpper(name))
+	for _, p := range list {
+		fmt.Fprintf(&b, "\n- %s", p.What)
+		if p.Where != "" {
+			fmt.Fprintf(&b, " at %s", p.Where)
+		}
+		fmt.Fprintf(&b, ", %s: ", p.When())
+		switch {
+		case p.Status == Agreed:
+			b.WriteString("agreed")
+		case p.Status == Cancelled:
+			b.WriteString("called off")
+		case p.ProposedBy == "me":
+			b.WriteString("you suggested it, no answer yet")
+		default:
+			b.WriteString("they suggested it, you haven't said yes")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,153 @@
+package plans
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"whatsapp-bot/migrate/migratetest"
+)
+
+func TestExtract(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC) // A Tuesday
+	var prompt string
+	e := &Extractor{Complete: func(_ context.Context, system, user string) (string, error) {
+		prompt = user
+		return `Sure! {"plans": [
+			{"id": 0, "what": "drinks", "where": "Port Said", "date": "2025-06-12", "time": "20:00", "proposed_by": "them", "status": "agreed", "agreed_in_last_message": true},
+			{"what": "movie", "date": "", "proposed_by": "me", "status": "proposed", "agreed_in_last_message": true},
+			{"what": "", "status": "agreed"}
+		]}`, nil
+	}}
+	found, err := e.Extract(context.Background(), "Noa", []Line{
+		{Speaker: "them", Text: "drinks thursday at port said? 8pm"},
+		{Speaker: "me", Text: "sure, see you there"},
+	}, []Plan{{ID: 7, What: "dinner", Status: Proposed}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompt, "Tuesday 2025-06-10") || !strings.Contains(prompt, "id 7: dinner") || !strings.Contains(prompt, "Noa: drinks") {
+		t.Errorf("prompt lacks context:\n%s", prompt)
+	}
+	if len(found) != 2 {
+		t.Fatalf("found = %+v", found)
+	}
+	drinks := found[0]
+	if !drinks.Start.Equal(time.Date(2025, 6, 12, 20, 0, 0, 0, time.UTC)) || drinks.AllDay || !drinks.InReply || drinks.Where != "Port Said" {
+		t.Errorf("drinks = %+v", drinks)
+	}
+	// Only an agreement can be agreed in the reply
+	if movie := found[1]; movie.InReply || !movie.Start.IsZero() || movie.ProposedBy != "me" {
+		t.Errorf("movie = %+v", movie)
+	}
+}
+
+func TestRecordAndUpcoming(t *testing.T) {
+	ctx := context.Background()
+	migratetest.Each(t, Open, func(t *testing.T, s *Store) {
+		now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+		thursday := time.Date(2025, 6, 12, 0, 0, 0, 0, time.UTC)
+
+		agreed, err := s.Record(ctx, "chat", []Found{
+			{Plan: Plan{What: "drinks", Start: thursday, AllDay: true, ProposedBy: "them", Status: Proposed}},
+			{Plan: Plan{What: "movie night", ProposedBy: "me", Status: Proposed}},
+		}, now)
+		if err != nil || len(agreed) != 0 {
+			t.Fatalf("first record: %v %v", agreed, err)
+		}
+
+		// The drinks get a time and a yes; the movie is matched by its words
+		later := now.Add(time.Hour)
+		agreed, err = s.Record(ctx, "chat", []Found{
+			{Plan: Plan{What: "drinks", Start: thursday.Add(20 * time.Hour), ProposedBy: "them", Status: Agreed}, InReply: true},
+			{Plan: Plan{What: "the movie", ProposedBy: "me", Status: Proposed}},
+		}, later)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(agreed) != 1 || agreed[0].What != "drinks" || !agreed[0].InReply {
+			t.Errorf("newly agreed = %+v", agreed)
+		}
+		// Agreeing again isn't news
+		if again, _ := s.Record(ctx, "chat", []Found{{Plan: Plan{What: "drinks", Start: thursday, AllDay: true, Status: Agreed}}}, later); len(again) != 0 {
+			t.Errorf("agreed twice: %+v", again)
+		}
+
+		list, err := s.Upcoming(ctx, "chat", later)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 2 || list[0].What != "drinks" || list[0].AllDay || list[0].Start.Hour() != 20 || list[1].What != "movie night" {
+			t.Fatalf("upcoming = %+v", list)
+		}
+		if others, _ := s.Upcoming(ctx, "other", later); len(others) != 0 {
+			t.Errorf("other contact's plans = %+v", others)
+		}
+		// Past plans drop off
+		if past, _ := s.Upcoming(ctx, "chat", thursday.Add(48*time.Hour)); len(past) != 1 {
+			t.Errorf("after thursday = %+v", past)
+		}
+
+		p := Prompt("Noa", list)
+		for _, want := range []string{"PLANS WITH NOA", "drinks, Thu 12 Jun 20:00: agreed", "movie night, no date yet: you suggested it"} {
+			if !strings.Contains(p, want) {
+				t.Errorf("prompt lacks %q:\n%s", want, p)
+			}
+		}
+	})
+}
+
+func TestICS(t *testing.T) {
+	at := time.Date(2025, 6, 12, 20, 0, 0, 0, time.UTC)
+	out := string(ICS([]Plan{
+		{ID: 1, Contact: "chat", What: "drinks, then dinner", Where: "Port Said; Tel Aviv", Start: at, Status: Agreed, Updated: at},
+		{ID: 2, Contact: "chat", What: "brunch", Start: at, AllDay: true, ProposedBy: "me", Status: Proposed, Updated: at},
+		{ID: 3, Contact: "chat", What: "movie", Status: Proposed},
+		{ID: 4, Contact: "chat", What: "gym", Start: at, Status: Declined},
+	}, func(string) string { return "Noa" }, at))
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n", "UID:plan-1@whatsapp-bot", "DTSTART:20250612T200000Z", "DTEND:20250612T210000Z",
+		`SUMMARY:drinks\, then dinner with Noa`, `LOCATION:Port Said\; Tel Aviv`, "STATUS:CONFIRMED",
+		"DTSTART;VALUE=DATE:20250612", "DTEND;VALUE=DATE:20250613", "STATUS:TENTATIVE", "END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("ics lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "movie") || strings.Contains(out, "gym") {
+		t.Errorf("undated or declined plan exported:\n%s", out)
+	}
+	for _, l := range strings.Split(out, "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("line longer than 75 bytes: %q", l)
+		}
+	}
+}
+
+func TestMentions(t *testing.T) {
+	for _, text := range []string{"drinks thursday?", "free at 8pm?", "מחר בערב?", "נפגש ב-8?", "let's do it"} {
+		if !Mentions(text) {
+			t.Errorf("Mentions(%q) = false", text)
+		}
+	}
+	for _, text := range []string{"lol", "that's hilarious", "איזה מצחיק"} {
+		if Mentions(text) {
+			t.Errorf("Mentions(%q) = true", text)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	long := "DESCRIPTION:" + strings.Repeat("שלום ", 40)
+	folded := fold(long)
+	if strings.ReplaceAll(folded, "\r\n ", "") != long {
+		t.Error("unfolding doesn't give the line back")
+	}
+	for _, l := range strings.Split(folded, "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("folded line of %d bytes", len(l))
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package ratelimit keeps a token bucket per chat, so a contact spamming
+// messages can't grow history and LLM usage without bound, and the account
+// never sends at a pace WhatsApp would flag as automated.
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Action is what happens to an event over the limit
+type Action string
+
+const (
+	Defer Action = "defer" // Hold it until the bucket refills
+	Drop  Action = "drop"  // Discard it
+	Busy  Action = "busy"  // Persona says it's busy (once), then discard
+)
+
+// Limit allows N events per Per, in bursts of up to N. N = 0 is unlimited.
+type Limit struct {
+	N      int
+	Per    time.Duration
+	Action Action
+}
+
+// ParseLimit reads "N/duration:action", e.g. "30/10m:defer". "off" or ""
+// is unlimited.
+func ParseLimit(spec string) (Limit, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "off" {
+		return Limit{}, nil
+	}
+	rate, action, ok := strings.Cut(spec, ":")
+	if !ok {
+		action = string(Defer)
+	}
+	count, window, ok := strings.Cut(rate, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("%q: want N/duration[:action]", spec)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("%q: bad count", spec)
+	}
+	per, err := time.ParseDuration(strings.TrimSpace(window))
+	if err != nil || per <= 0 {
+		return Limit{}, fmt.Errorf("%q: bad duration", spec)
+	}
+	switch a := Action(strings.TrimSpace(action)); a {
+	case Defer, Drop, Busy:
+		return Limit{N: n, Per: per, Action: a}, nil
+	default:
+		return Limit{}, fmt.Errorf("%q: action must be defer, drop or busy", spec)
+	}
+}
+
+func (l Limit) String() string {
+	if l.N == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s:%s", l.N, l.Per, l.Action)
+}
+
+// Decision is the outcome of Take
+type Decision struct {
+	Allowed bool
+	Wait    time.Duration // Until the next token, when not allowed
+	First   bool          // First refusal since the last allowed event
+	Action  Action        // What to do when not allowed
+}
+
+// Limiter holds one bucket per key (chat)
+type Limiter struct {
+	Limit   Limit
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens  float64
+	last    time.Time
+	refused bool
+}
+
+func NewLimiter(l Limit) *Limiter {
+	return &Limiter{Limit: l, buckets: map[string]*bucket{}}
+}
+
+// Take spends a token for key if one is available
+func (l *Limiter) Take(key string, now time.Time) Decision {
+	if l.Limit.N == 0 {
+		return Decision{Allowed: true}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Limit.N), last: now}
+		l.buckets[key] = b
+	}
+	perToken := l.Limit.Per / time.Duration(l.Limit.N)
+	b.tokens = min(float64(l.Limit.N), b.tokens+float64(now.Sub(b.last))/float64(perToken))
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.refused = false
+		return Decision{Allowed: true}
+	}
+	d := Decision{
+		Wait:   time.Duration((1 - b.tokens) * float64(perToken)),
+		First:  !b.refused,
+		Action: l.Limit.Action,
+	}
+	b.refused = true
+	return d
+}
+
+// Backlog holds events a Defer limit refused, per key and in arrival order,
+// and releases them as the bucket refills. Each key has at most Cap events
+// waiting and one timer running, however many arrive.
+type Backlog[T any] struct {
+	Limiter *Limiter
+	Cap     int                   // Events waiting per key; 0 = the limit's N
+	Release func(key string, e T) // Called in order, from the drain goroutine
+
+	mu       sync.Mutex
+	queues   map[string][]T
+	draining map[string]bool // A timer is pending or drain is running
+}
+
+func NewBacklog[T any](l *Limiter, release func(key string, e T)) *Backlog[T] {
+	return &Backlog[T]{Limiter: l, Release: release, queues: map[string][]T{}, draining: map[string]bool{}}
+}
+
+// Admit spends a token for e. If none is left and the action is Defer, e
+// waits in the backlog (queued) unless the backlog is full. While earlier
+// events wait, e queues behind them without spending a token, so events
+// never overtake each other. With other actions the caller carries out
+// d.Action.
+func (b *Backlog[T]) Admit(key string, e T, now time.Time) (d Decision, queued bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.queues[key]) > 0 {
+		return Decision{Action: Defer}, b.hold(key, e)
+	}
+	d = b.Limiter.Take(key, now)
+	if d.Allowed || d.Action != Defer {
+		return d, false
+	}
+	if !b.hold(key, e) {
+		return d, false
+	}
+	if !b.draining[key] {
+		b.draining[key] = true
+		time.AfterFunc(d.Wait, func() { b.drain(key) })
+	}
+	return d, true
+}
+
+// Len is how many events wait for key
+func (b *Backlog[T]) Len(key string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.queues[key])
+}
+
+// hold appends e unless the backlog for key is full; caller holds b.mu
+func (b *Backlog[T]) hold(key string, e T) bool {
+	limit := b.Cap
+	if limit <= 0 {
+		limit = max(b.Limiter.Limit.N, 1)
+	}
+	if len(b.queues[key]) >= limit {
+		return false
+	}
+	b.queues[key] = append(b.queues[key], e)
+	return true
+}
+
+// drain releases waiting events while tokens last, then sleeps until the
+// next one
+func (b *Backlog[T]) drain(key string) {
+	for {
+		b.mu.Lock()
+		queue := b.queues[key]
+		if len(queue) == 0 {
+			delete(b.draining, key)
+			b.mu.Unlock()
+			return
+		}
+		if d := b.Limiter.Take(key, time.Now()); !d.Allowed {
+			time.AfterFunc(d.Wait, func() { b.drain(key) })
+			b.mu.Unlock()
+			return
+		}
+		next := queue[0]
+		if len(queue) == 1 {
+			delete(b.queues, key)
+		} else {
+			b.queues[key] = queue[1:]
+		}
+		b.mu.Unlock()
+		b.Release(key, next)
+	}
+}
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	for _, c := range []struct {
+		spec string
+		want Limit
+		bad  bool
+	}{
+		{"", Limit{}, false},
+		{"off", Limit{}, false},
+		{"30/10m", Limit{30, 10 * time.Minute, Defer}, false},
+		{"20/1h:drop", Limit{20, time.Hour, Drop}, false},
+		{" 5 / 1m : busy ", Limit{5, time.Minute, Busy}, false},
+		{"5", Limit{}, true},
+		{"0/1m", Limit{}, true},
+		{"5/soon", Limit{}, true},
+		{"5/1m:shout", Limit{}, true},
+	} {
+		got, err := ParseLimit(c.spec)
+		if (err != nil) != c.bad || got != c.want {
+			t.Errorf("ParseLimit(%q) = %+v, %v", c.spec, got, err)
+		}
+	}
+}
+
+func TestTake(t *testing.T) {
+	for _, action := range []Action{Defer, Drop, Busy} {
+		l := NewLimiter(Limit{N: 2, Per: time.Minute, Action: action})
+		now := time.Now()
+		for i, want := range []Decision{
+			{Allowed: true},
+			{Allowed: true},
+			{Wait: 30 * time.Second, First: true, Action: action},
+			{Wait: 30 * time.Second, Action: action}, // Only the first refusal is First
+		} {
+			if got := l.Take("a", now); got != want {
+				t.Errorf("%s: Take #%d = %+v, want %+v", action, i+1, got, want)
+			}
+		}
+		if d := l.Take("b", now); !d.Allowed {
+			t.Errorf("%s: buckets shared between keys", action)
+		}
+		// Half a window later one token is back, and refusals start over
+		later := now.Add(30 * time.Second)
+		if d := l.Take("a", later); !d.Allowed {
+			t.Errorf("%s: bucket didn't refill: %+v", action, d)
+		}
+		if d := l.Take("a", later); d.Allowed || !d.First {
+			t.Errorf("%s: refusal after refill = %+v, want First", action, d)
+		}
+	}
+	if d := NewLimiter(Limit{}).Take("a", time.Now()); !d.Allowed {
+		t.Error("unlimited limiter refused")
+	}
+}
+
+func TestBacklog(t *testing.T) {
+	var mu sync.Mutex
+	var released []int
+	l := NewLimiter(Limit{N: 2, Per: 100 * time.Millisecond, Action: Defer})
+	b := NewBacklog(l, func(key string, e int) {
+		mu.Lock()
+		released = append(released, e)
+		mu.Unlock()
+	})
+
+	now := time.Now()
+	var queued []bool
+	for e := 1; e <= 5; e++ {
+		d, q := b.Admit("a", e, now)
+		if d.Allowed != (e <= 2) {
+			t.Errorf("Admit(%d) allowed = %v", e, d.Allowed)
+		}
+		queued = append(queued, q)
+	}
+	// Two allowed, two waiting (the cap is N), one dropped
+	if want := []bool{false, false, true, true, false}; !slices.Equal(queued, want) {
+		t.Errorf("queued = %v, want %v", queued, want)
+	}
+	if n := b.Len("a"); n != 2 {
+		t.Errorf("Len = %d, want 2", n)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for b.Len("a") > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(released) != 2 || released[0] != 3 || released[1] != 4 {
+		t.Errorf("released %v, want [3 4] in order", released)
+	}
+}
+
+func TestBacklogOtherActions(t *testing.T) {
+	for _, action := range []Action{Drop, Busy} {
+		l := NewLimiter(Limit{N: 1, Per: time.Hour, Action: action})
+		b := NewBacklog(l, func(string, int) { t.Errorf("%s: released", action) })
+		b.Admit("a", 1, time.Now())
+		d, queued := b.Admit("a", 2, time.Now())
+		if d.Allowed || queued || d.Action != action {
+			t.Errorf("%s: Admit = %+v queued %v", action, d, queued)
+		}
+	}
+}
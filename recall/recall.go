@@ -0,0 +1,367 @@
+// Package recall is a searchable archive of everything said with each
+// target, synced history included. Messages are embedded in the background
+// by a local embedding model and the vectors kept in the bot's SQL
+// database; Search finds the past messages closest in meaning to what was
+// just said, so the persona can pick up on things long out of its history
+// window.
+package recall
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"whatsapp-bot/migrate"
+)
+
+// EmbedFunc turns text into a vector with the local embedding model
+type EmbedFunc func(ctx context.Context, text string) ([]float32, error)
+
+// Entry is one archived message
+type Entry struct {
+	ID      int64
+	Contact string // chatKey of the target
+	MsgID   string // WhatsApp message ID; a message is archived once
+	Speaker string // "them" or "me"
+	Text    string
+	At      time.Time
+}
+
+// Hit is a search result
+type Hit struct {
+	Entry
+	Score float64 // Cosine similarity to the query, -1 to 1
+}
+
+// migrations of bot_archive; append only
+var migrations = []migrate.Step{
+	{
+		SQLite: `CREATE TABLE bot_archive (
+	id        INTEGER PRIMARY KEY,
+	contact   TEXT NOT NULL,
+	msg_id    TEXT NOT NULL,
+	speaker   TEXT NOT NULL,
+	text      TEXT NOT NULL,
+	sent_at   BIGINT NOT NULL,
+	model     TEXT NOT NULL DEFAULT '',
+	embedding BLOB,
+	UNIQUE (contact, msg_id)
+)`,
+		Postgres: `CREATE TABLE bot_archive (
+	id        BIGSERIAL PRIMARY KEY,
+	contact   TEXT NOT NULL,
+	msg_id    TEXT NOT NULL,
+	speaker   TEXT NOT NULL,
+	text      TEXT NOT NULL,
+	sent_at   BIGINT NOT NULL,
+	model     TEXT NOT NULL DEFAULT '',
+	embedding BYTEA,
+	UNIQUE (contact, msg_id)
+)`,
+	},
+	{SQLite: `CREATE INDEX bot_archive_model ON bot_archive (contact, model)`},
+	// Failed embeddings: attempts moves a message to the back of the queue,
+	// failed_model gives up on it for that model
+	{SQLite: `ALTER TABLE bot_archive ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0`},
+	{SQLite: `ALTER TABLE bot_archive ADD COLUMN failed_model TEXT NOT NULL DEFAULT ''`},
+}
+
+// vector is an embedded entry, normalized so similarity is a dot product
+type vector struct {
+	entry Entry
+	v     []float32
+}
+
+// Archive stores messages and searches them. Run embeds what Add stores.
+type Archive struct {
+	db    *sql.DB
+	embed EmbedFunc
+	model string
+
+	Batch int           // Messages embedded per pass
+	Retry time.Duration // Wait after the embedding model fails, doubled while it keeps failing, up to an hour
+
+	mu    sync.Mutex
+	index map[string][]vector // contact -> embedded entries, loaded on first search
+	wake  chan struct{}
+}
+
+// New creates or upgrades the archive table. model names the embedding
+// model: messages embedded by another model are embedded again.
+func New(ctx context.Context, db *sql.DB, dialect migrate.Dialect, model string, embed EmbedFunc) (*Archive, error) {
+	if err := migrate.Apply(ctx, db, dialect, "recall", migrations); err != nil {
+		return nil, err
+	}
+	return &Archive{
+		db:    db,
+		embed: embed,
+		model: model,
+		Batch: 32,
+		Retry: 30 * time.Second,
+		index: map[string][]vector{},
+		wake:  make(chan struct{}, 1),
+	}, nil
+}
+
+// Add archives a message for embedding. Returns false if the message was
+// archived before, or has no text to embed.
+func (a *Archive) Add(ctx context.Context, e Entry) (bool, error) {
+	if strings.TrimSpace(e.Text) == "" {
+		return false, nil
+	}
+	res, err := a.db.ExecContext(ctx,
+		`INSERT INTO bot_archive (contact, msg_id, speaker, text, sent_at) VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (contact, msg_id) DO NOTHING`,
+		e.Contact, e.MsgID, e.Speaker, e.Text, e.At.UnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("failed to archive message: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+	return true, nil
+}
+
+// pending selects messages not yet embedded by the current model, leaving
+// out those it failed on
+const pending = `(embedding IS NULL OR model <> $1) AND failed_model <> $1`
+
+// Pending counts messages not yet embedded by the current model
+func (a *Archive) Pending(ctx context.Context) (int, error) {
+	var n int
+	err := a.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM bot_archive WHERE `+pending, a.model).Scan(&n)
+	return n, err
+}
+
+// Run embeds archived messages until ctx is cancelled
+func (a *Archive) Run(ctx context.Context) {
+	var backoff time.Duration
+	for {
+		wait := time.Duration(0)
+		done, err := a.embedPending(ctx)
+		switch {
+		case err != nil:
+			if backoff == 0 {
+				fmt.Printf("⚠️  Recall: embedding failed, retrying in %s and backing off: %v\n", a.Retry, err)
+				backoff = a.Retry
+			} else {
+				backoff = min(2*backoff, time.Hour)
+			}
+			wait = backoff
+		case done == 0:
+			backoff, wait = 0, time.Hour
+		default:
+			backoff = 0
+		}
+		if wait == 0 {
+			continue
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-a.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// embedPending embeds one batch, returns how many were embedded. Messages
+// that failed before come last, so one that always fails can't hold up the
+// rest. A message that fails while others embed fine is given up on for
+// this model. If nothing embeds, the model itself is likely down: the pass
+// stops after two failures, and the error is returned.
+func (a *Archive) embedPending(ctx context.Context) (int, error) {
+	rows, err := a.db.QueryContext(ctx,
+		`SELECT id, contact, msg_id, speaker, text, sent_at FROM bot_archive
+		 WHERE `+pending+` ORDER BY attempts, id LIMIT $2`, a.model, a.Batch)
+	if err != nil {
+		return 0, err
+	}
+	var batch []Entry
+	for rows.Next() {
+		var e Entry
+		var at int64
+		if err := rows.Scan(&e.ID, &e.Contact, &e.MsgID, &e.Speaker, &e.Text, &at); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		e.At = time.UnixMilli(at)
+		batch = append(batch, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	type failure struct {
+		Entry
+		err error
+	}
+	done := 0
+	var failed []failure
+	for _, e := range batch {
+		v, err := a.embed(ctx, e.Text)
+		if err != nil {
+			failed = append(failed, failure{e, err})
+			if done == 0 && len(failed) >= 2 {
+				break
+			}
+			continue
+		}
+		v = normalize(v)
+		a.mu.Lock()
+		_, err = a.db.ExecContext(ctx,
+			`UPDATE bot_archive SET model = $1, embedding = $2 WHERE id = $3`, a.model, encode(v), e.ID)
+		if err == nil {
+			if loaded, ok := a.index[e.Contact]; ok && len(v) > 0 {
+				a.index[e.Contact] = append(loaded, vector{e, v})
+			}
+		}
+		a.mu.Unlock()
+		if err != nil {
+			return done, err
+		}
+		done++
+	}
+
+	for _, e := range failed {
+		giveUp := ""
+		if done > 0 {
+			giveUp = a.model
+			fmt.Printf("⚠️  Recall: skipping message %s, it can't be embedded: %v\n", e.MsgID, e.err)
+		}
+		_, err := a.db.ExecContext(ctx,
+			`UPDATE bot_archive SET attempts = attempts + 1, failed_model = $1 WHERE id = $2`, giveUp, e.ID)
+		if err != nil {
+			return done, err
+		}
+	}
+	if done == 0 && len(failed) > 0 {
+		return 0, failed[0].err
+	}
+	return done, nil
+}
+
+// Search returns up to k of the contact's archived messages most similar to
+// query, scoring at least minScore, best first. Entries skip reports true
+// for (e.g. those already in the prompt) are left out.
+func (a *Archive) Search(ctx context.Context, contact, query string, k int, minScore float64, skip func(Entry) bool) ([]Hit, error) {
+	q, err := a.embed(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	q = normalize(q)
+
+	a.mu.Lock()
+	vectors, err := a.load(ctx, contact)
+	a.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var hits []Hit
+	for _, v := range vectors {
+		if len(v.v) != len(q) || (skip != nil && skip(v.entry)) {
+			continue
+		}
+		if score := dot(v.v, q); score >= minScore {
+			hits = append(hits, Hit{v.entry, score})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits, nil
+}
+
+// load returns the contact's embedded entries, reading them on first use.
+// Called with mu held; the slice is only ever appended to, so it's safe to
+// read after unlocking.
+func (a *Archive) load(ctx context.Context, contact string) ([]vector, error) {
+	if vectors, ok := a.index[contact]; ok {
+		return vectors, nil
+	}
+	rows, err := a.db.QueryContext(ctx,
+		`SELECT id, msg_id, speaker, text, sent_at, embedding FROM bot_archive
+		 WHERE contact = $1 AND model = $2 AND embedding IS NOT NULL`, contact, a.model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vectors := []vector{}
+	for rows.Next() {
+		e := Entry{Contact: contact}
+		var at int64
+		var raw []byte
+		if err := rows.Scan(&e.ID, &e.MsgID, &e.Speaker, &e.Text, &at, &raw); err != nil {
+			return nil, err
+		}
+		e.At = time.UnixMilli(at)
+		if v := decode(raw); len(v) > 0 {
+			vectors = append(vectors, vector{e, v})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	a.index[contact] = vectors
+	return vectors, nil
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return nil
+	}
+	norm := math.Sqrt(sum)
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+// encode stores a vector as little-endian float32s
+func encode(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return buf
+}
+
+func decode(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v
+}
@@ -0,0 +1,163 @@
+package recall
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"whatsapp-bot/migrate"
+	"whatsapp-bot/migrate/migratetest"
+)
+
+// wordEmbed is a stand-in embedding model: one dimension per known word
+func wordEmbed(_ context.Context, text string) ([]float32, error) {
+	vocab := []string{"dog", "beach", "exam", "pizza", "trip"}
+	v := make([]float32, len(vocab))
+	for i, w := range vocab {
+		v[i] = float32(strings.Count(strings.ToLower(text), w))
+	}
+	return v, nil
+}
+
+func openArchive(t *testing.T, db *sql.DB, dialect migrate.Dialect, model string) *Archive {
+	t.Helper()
+	a, err := New(context.Background(), db, dialect, model, wordEmbed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestSearchFindsArchivedMessages(t *testing.T) {
+	ctx := context.Background()
+	migratetest.Run(t, func(t *testing.T, db *sql.DB, dialect migrate.Dialect) {
+		a := openArchive(t, db, dialect, "test")
+
+		at := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+		for i, text := range []string{
+			"took the dog to the beach",
+			"exam tomorrow, wish me luck",
+			"pizza tonight?",
+			"the dog ate my exam notes",
+		} {
+			e := Entry{Contact: "chat", MsgID: string(rune('a' + i)), Speaker: "them", Text: text, At: at}
+			if added, err := a.Add(ctx, e); err != nil || !added {
+				t.Fatalf("add %q: %v %v", text, added, err)
+			}
+		}
+		if added, _ := a.Add(ctx, Entry{Contact: "chat", MsgID: "a", Speaker: "them", Text: "again"}); added {
+			t.Error("same message archived twice")
+		}
+		a.Add(ctx, Entry{Contact: "other", MsgID: "a", Speaker: "them", Text: "dog dog dog"})
+
+		// Search before embedding loads an empty index that Run then fills
+		if hits, _ := a.Search(ctx, "chat", "dog", 3, 0.1, nil); len(hits) != 0 {
+			t.Errorf("hits before embedding: %+v", hits)
+		}
+		if n, err := a.embedPending(ctx); err != nil || n != 5 {
+			t.Fatalf("embedded %d, %v", n, err)
+		}
+		if n, _ := a.Pending(ctx); n != 0 {
+			t.Errorf("%d still pending", n)
+		}
+
+		hits, err := a.Search(ctx, "chat", "remember the beach with the dog?", 3, 0.4, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hits) != 2 || hits[0].Text != "took the dog to the beach" || !hits[0].At.Equal(at) {
+			t.Errorf("hits = %+v", hits)
+		}
+
+		skip := func(e Entry) bool { return e.MsgID == "a" }
+		hits, _ = a.Search(ctx, "chat", "the dog", 3, 0.5, skip)
+		if len(hits) != 1 || hits[0].Text != "the dog ate my exam notes" {
+			t.Errorf("hits with skip = %+v", hits)
+		}
+	})
+}
+
+func TestNewModelEmbedsAgain(t *testing.T) {
+	ctx := context.Background()
+	migratetest.Run(t, func(t *testing.T, db *sql.DB, dialect migrate.Dialect) {
+		old := openArchive(t, db, dialect, "old")
+
+		old.Add(ctx, Entry{Contact: "chat", MsgID: "1", Speaker: "me", Text: "trip to the beach", At: time.Now()})
+		old.embedPending(ctx)
+
+		a := openArchive(t, db, dialect, "new")
+		if n, _ := a.Pending(ctx); n != 1 {
+			t.Fatalf("pending after model change = %d, want 1", n)
+		}
+		if hits, _ := a.Search(ctx, "chat", "beach", 1, 0.1, nil); len(hits) != 0 {
+			t.Errorf("vectors of another model searched: %+v", hits)
+		}
+		a.embedPending(ctx)
+		if hits, _ := a.Search(ctx, "chat", "beach", 1, 0.1, nil); len(hits) != 1 {
+			t.Errorf("re-embedded message not found: %+v", hits)
+		}
+	})
+}
+
+// A message that never embeds must not hold up the ones after it, and
+// an embedding model that's down must not make messages look unembeddable
+func TestFailingMessageDoesNotBlock(t *testing.T) {
+	ctx := context.Background()
+	migratetest.Run(t, func(t *testing.T, db *sql.DB, dialect migrate.Dialect) {
+		down := false
+		a, err := New(ctx, db, dialect, "test", func(ctx context.Context, text string) ([]float32, error) {
+			if down || strings.Contains(text, "poison") {
+				return nil, errors.New("empty embedding")
+			}
+			return wordEmbed(ctx, text)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.Batch = 2
+
+		if added, _ := a.Add(ctx, Entry{Contact: "chat", MsgID: "empty", Speaker: "them", Text: " ", At: time.Now()}); added {
+			t.Error("empty message archived")
+		}
+		for i, text := range []string{"poison 1", "poison 2", "dog", "beach"} {
+			a.Add(ctx, Entry{Contact: "chat", MsgID: string(rune('a' + i)), Speaker: "them", Text: text, At: time.Now()})
+		}
+
+		// The model is down: nothing is given up on
+		down = true
+		if _, err := a.embedPending(ctx); err == nil {
+			t.Fatal("no error while the model is down")
+		}
+		if n, _ := a.Pending(ctx); n != 4 {
+			t.Errorf("pending = %d while the model is down, want 4", n)
+		}
+
+		// Back up: the two that failed go last, so the good ones get through
+		down = false
+		if n, err := a.embedPending(ctx); err != nil || n != 2 {
+			t.Fatalf("embedded %d, %v; want the 2 good messages", n, err)
+		}
+		if hits, _ := a.Search(ctx, "chat", "beach", 1, 0.5, nil); len(hits) != 1 {
+			t.Errorf("message behind failing ones not searchable: %+v", hits)
+		}
+		// Once something embeds in the same pass, the poisoned ones are
+		// given up on
+		a.Add(ctx, Entry{Contact: "chat", MsgID: "e", Speaker: "them", Text: "pizza", At: time.Now()})
+		a.Batch = 3
+		if n, err := a.embedPending(ctx); err != nil || n != 1 {
+			t.Fatalf("embedded %d, %v; want 1", n, err)
+		}
+		if n, _ := a.Pending(ctx); n != 0 {
+			t.Errorf("pending = %d, want the poisoned messages given up on", n)
+		}
+
+		// A new model tries them again
+		b, _ := New(ctx, db, dialect, "other", wordEmbed)
+		if n, _ := b.Pending(ctx); n != 5 {
+			t.Errorf("pending for a new model = %d, want 5", n)
+		}
+	})
+}
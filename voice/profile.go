@@ -0,0 +1,359 @@
+package voice
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Profile describes how someone texts
+type Profile struct {
+	Samples int
+	Words   [4]int // Words per message at the 25th, 50th, 75th and 90th percentile
+
+	Emoji    float64  // Share of messages with an emoji
+	TopEmoji []string // Most used first
+
+	Lowercase float64 // Share of messages with letters but no capitals
+	Period    float64 // Share ending in a full stop
+	Exclaim   float64 // Share with "!"
+	Question  float64 // Share with "?"
+	Ellipsis  float64 // Share with "..." or "…"
+
+	Phrases []string      // Words and short phrases they keep using
+	Scripts []ScriptShare // Writing systems, most used first
+}
+
+// ScriptShare is the share of messages mostly written in a script
+type ScriptShare struct {
+	Script string // "Latin", "Hebrew", ...
+	Share  float64
+}
+
+var scripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin}, {"Hebrew", unicode.Hebrew}, {"Arabic", unicode.Arabic},
+	{"Cyrillic", unicode.Cyrillic}, {"Greek", unicode.Greek}, {"Han", unicode.Han},
+	{"Devanagari", unicode.Devanagari}, {"Thai", unicode.Thai},
+}
+
+// Build profiles a set of messages
+func Build(texts []string) Profile {
+	p := Profile{Samples: len(texts)}
+	if len(texts) == 0 {
+		return p
+	}
+
+	lengths := make([]int, 0, len(texts))
+	emoji := map[string]int{}
+	phrases := map[string]int{}
+	byScript := map[string]int{}
+	var withEmoji, lower, cased, period, exclaim, question, ellipsis int
+	for _, t := range texts {
+		t = strings.TrimSpace(t)
+		lengths = append(lengths, len(strings.Fields(t)))
+
+		found := false
+		for _, e := range emojiIn(t) {
+			emoji[e]++
+			found = true
+		}
+		if found {
+			withEmoji++
+		}
+
+		if hasUpper, hasLower := caseOf(t); hasUpper || hasLower {
+			cased++
+			if !hasUpper {
+				lower++
+			}
+		}
+		if strings.HasSuffix(t, ".") && !strings.HasSuffix(t, "..") {
+			period++
+		}
+		if strings.Contains(t, "!") {
+			exclaim++
+		}
+		if strings.Contains(t, "?") {
+			question++
+		}
+		if strings.Contains(t, "...") || strings.Contains(t, "…") {
+			ellipsis++
+		}
+
+		// Each phrase counts once per message
+		seen := map[string]bool{}
+		ws := phraseWords(t)
+		for n := 1; n <= 3; n++ {
+			for i := 0; i+n <= len(ws); i++ {
+				if ph := strings.Join(ws[i:i+n], " "); !seen[ph] {
+					seen[ph] = true
+					phrases[ph]++
+				}
+			}
+		}
+
+		if s := mainScript(t); s != "" {
+			byScript[s]++
+		}
+	}
+
+	sort.Ints(lengths)
+	for i, q := range []float64{0.25, 0.5, 0.75, 0.9} {
+		p.Words[i] = lengths[int(q*float64(len(lengths)-1))]
+	}
+	share := func(n, of int) float64 {
+		if of == 0 {
+			return 0
+		}
+		return float64(n) / float64(of)
+	}
+	p.Emoji = share(withEmoji, len(texts))
+	p.TopEmoji = top(emoji, 5, 2)
+	p.Lowercase = share(lower, cased)
+	p.Period = share(period, len(texts))
+	p.Exclaim = share(exclaim, len(texts))
+	p.Question = share(question, len(texts))
+	p.Ellipsis = share(ellipsis, len(texts))
+	p.Phrases = pickPhrases(phrases, len(texts))
+
+	total := 0
+	for _, n := range byScript {
+		total += n
+	}
+	for _, s := range top(byScript, len(byScript), 1) {
+		p.Scripts = append(p.Scripts, ScriptShare{s, share(byScript[s], total)})
+	}
+	return p
+}
+
+// Describe renders the profile as prompt guidance
+func (p Profile) Describe() string {
+	var lines []string
+	lines = append(lines, fmt.Sprintf("Length: usually %d-%d words (typically %d), rarely over %d",
+		max(p.Words[0], 1), max(p.Words[2], 1), max(p.Words[1], 1), max(p.Words[3], 1)))
+
+	if p.Emoji < 0.05 {
+		lines = append(lines, "Emoji: almost never")
+	} else {
+		line := fmt.Sprintf("Emoji: in about %s of messages", percent(p.Emoji))
+		if len(p.TopEmoji) > 0 {
+			line += ", mostly " + strings.Join(p.TopEmoji, " ")
+		}
+		lines = append(lines, line)
+	}
+
+	switch {
+	case p.Lowercase >= 0.7:
+		lines = append(lines, "Casing: all lowercase, no capitals")
+	case p.Lowercase >= 0.3:
+		lines = append(lines, "Casing: often all lowercase")
+	default:
+		lines = append(lines, "Casing: normal capitalization")
+	}
+
+	var punct []string
+	if p.Period < 0.15 {
+		punct = append(punct, "rarely ends with a full stop")
+	} else {
+		punct = append(punct, fmt.Sprintf("ends with a full stop %s of the time", percent(p.Period)))
+	}
+	if p.Exclaim >= 0.15 {
+		punct = append(punct, fmt.Sprintf("uses \"!\" a lot (%s)", percent(p.Exclaim)))
+	}
+	if p.Ellipsis >= 0.1 {
+		punct = append(punct, "likes \"...\"")
+	}
+	lines = append(lines, "Punctuation: "+strings.Join(punct, ", "))
+
+	if len(p.Phrases) > 0 {
+		lines = append(lines, "Keeps saying: \""+strings.Join(p.Phrases, "\", \"")+"\"")
+	}
+	if len(p.Scripts) > 1 && p.Scripts[1].Share >= 0.1 {
+		var mix []string
+		for _, s := range p.Scripts {
+			if s.Share >= 0.05 {
+				mix = append(mix, fmt.Sprintf("%s %s", s.Script, percent(s.Share)))
+			}
+		}
+		lines = append(lines, "Writes in: "+strings.Join(mix, ", ")+" (mixes them)")
+	} else if len(p.Scripts) == 1 && p.Scripts[0].Script != "Latin" {
+		lines = append(lines, "Writes in: "+p.Scripts[0].Script+" script")
+	}
+	return "- " + strings.Join(lines, "\n- ")
+}
+
+var (
+	hasLink   = regexp.MustCompile(`(?i)https?://|www\.|\.com\b`)
+	hasNumber = regexp.MustCompile(`\d{4,}`)
+)
+
+// Examples picks up to n messages spread over the usual lengths. Links,
+// long numbers and repeats are skipped: examples are for style, and
+// shouldn't carry details.
+func Examples(texts []string, n int) []string {
+	seen := map[string]bool{}
+	var pool []string
+	for _, t := range texts {
+		t = strings.TrimSpace(t)
+		words := len(strings.Fields(t))
+		if words == 0 || words > 30 || seen[strings.ToLower(t)] || hasLink.MatchString(t) || hasNumber.MatchString(t) {
+			continue
+		}
+		seen[strings.ToLower(t)] = true
+		pool = append(pool, t)
+	}
+	if len(pool) <= n {
+		return pool
+	}
+	sort.SliceStable(pool, func(i, j int) bool { return len(strings.Fields(pool[i])) < len(strings.Fields(pool[j])) })
+	out := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		// Evenly spaced, skipping the extremes at both ends
+		out = append(out, pool[(2*i+1)*len(pool)/(2*n)])
+	}
+	return out
+}
+
+// Prompt is the style section of the system prompt
+func (v Voice) Prompt() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n\nTEXTING STYLE (copy how the real person texts, learned from %d of their messages):\n%s", v.Profile.Samples, v.Profile.Describe())
+	if len(v.Examples) > 0 {
+		b.WriteString("\nReal messages of theirs, for style only (don't reuse what they say):")
+		for _, e := range v.Examples {
+			fmt.Fprintf(&b, "\n> %s", e)
+		}
+	}
+	return b.String()
+}
+
+func emojiIn(t string) []string {
+	var out []string
+	for _, r := range t {
+		if (r >= 0x1F000 && r <= 0x1FAFF && !(r >= 0x1F3FB && r <= 0x1F3FF)) || (r >= 0x2600 && r <= 0x27BF) || r == 0x2764 {
+			out = append(out, string(r))
+		}
+	}
+	return out
+}
+
+func caseOf(t string) (hasUpper, hasLower bool) {
+	for _, r := range t {
+		hasUpper = hasUpper || unicode.IsUpper(r)
+		hasLower = hasLower || unicode.IsLower(r)
+	}
+	return
+}
+
+// phraseWords are the lowercase words of a message, punctuation stripped
+func phraseWords(t string) []string {
+	return strings.FieldsFunc(strings.ToLower(t), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+}
+
+// commonWords are too ordinary to be anyone's pet phrase
+var commonWords = map[string]bool{
+	"i": true, "you": true, "a": true, "the": true, "to": true, "and": true, "it": true, "is": true,
+	"of": true, "in": true, "that": true, "me": true, "my": true, "for": true, "on": true, "do": true,
+	"so": true, "what": true, "be": true, "are": true, "was": true, "we": true, "i'm": true, "it's": true,
+	"this": true, "have": true, "at": true, "just": true, "with": true, "but": true, "not": true, "can": true,
+	"will": true, "your": true, "if": true, "he": true, "she": true, "they": true, "how": true,
+}
+
+// pickPhrases keeps phrases used in at least 3% of messages (and 3
+// times), preferring longer ones over the words inside them
+func pickPhrases(counts map[string]int, messages int) []string {
+	minCount := max(3, messages*3/100)
+	var cands []string
+	for ph, n := range counts {
+		if n < minCount {
+			continue
+		}
+		// A phrase of only common words says little
+		allCommon := true
+		for _, w := range strings.Fields(ph) {
+			allCommon = allCommon && commonWords[w]
+		}
+		if allCommon {
+			continue
+		}
+		cands = append(cands, ph)
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		if counts[cands[i]] != counts[cands[j]] {
+			return counts[cands[i]] > counts[cands[j]]
+		}
+		return cands[i] < cands[j]
+	})
+
+	var out []string
+	for _, ph := range cands {
+		covered := false
+		for _, kept := range out {
+			if strings.Contains(" "+kept+" ", " "+ph+" ") || strings.Contains(" "+ph+" ", " "+kept+" ") {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			out = append(out, ph)
+		}
+		if len(out) == 8 {
+			break
+		}
+	}
+	return out
+}
+
+// mainScript is the writing system most letters of t are in
+func mainScript(t string) string {
+	counts := map[string]int{}
+	for _, r := range t {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for _, s := range scripts {
+			if unicode.Is(s.table, r) {
+				counts[s.name]++
+				break
+			}
+		}
+	}
+	best := ""
+	for _, s := range scripts {
+		if counts[s.name] > counts[best] {
+			best = s.name
+		}
+	}
+	return best
+}
+
+// top returns up to n keys with at least minCount, most counted first
+func top(counts map[string]int, n, minCount int) []string {
+	var keys []string
+	for k, c := range counts {
+		if c >= minCount {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+func percent(f float64) string {
+	return fmt.Sprintf("%d%%", int(f*100+0.5))
+}
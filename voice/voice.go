@@ -0,0 +1,162 @@
+// Package voice learns how the owner texts: their own past messages (from
+// history sync and whenever they take over a chat) are kept per account,
+// summarized into a style profile (message length, emoji, casing,
+// punctuation, pet phrases, which scripts they write in) and turned into
+// prompt guidance with a few real examples, so a persona standing in for
+// the owner sounds like them.
+package voice
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"whatsapp-bot/migrate"
+)
+
+// Sample is one message the owner wrote
+type Sample struct {
+	MsgID string
+	Chat  string // Who it was sent to
+	Text  string
+	At    time.Time
+}
+
+// migrations of bot_voice_samples; append only
+var migrations = []migrate.Step{
+	{SQLite: `CREATE TABLE bot_voice_samples (
+	account TEXT NOT NULL,
+	msg_id  TEXT NOT NULL,
+	chat    TEXT NOT NULL,
+	text    TEXT NOT NULL,
+	sent_at BIGINT NOT NULL,
+	PRIMARY KEY (account, msg_id)
+)`},
+	{SQLite: `CREATE INDEX bot_voice_samples_recent ON bot_voice_samples (account, sent_at)`},
+}
+
+// Store keeps the owner's messages per account and caches their profile
+type Store struct {
+	db *sql.DB
+
+	MaxSamples int // Per account; the oldest are dropped beyond this
+	MinSamples int // Fewer than this and there's no profile yet
+
+	mu     sync.Mutex
+	cached map[string]Voice // account+chat -> last result, until a sample is added
+}
+
+// Voice is what the prompt gets: the profile and examples for one chat
+type Voice struct {
+	Profile  Profile
+	Examples []string
+}
+
+// Open creates or upgrades the samples table
+func Open(ctx context.Context, db *sql.DB, dialect migrate.Dialect) (*Store, error) {
+	if err := migrate.Apply(ctx, db, dialect, "voice", migrations); err != nil {
+		return nil, err
+	}
+	return &Store{db: db, MaxSamples: 2000, MinSamples: 30, cached: map[string]Voice{}}, nil
+}
+
+// Add keeps a message the owner wrote. Returns false if it was kept before.
+func (s *Store) Add(ctx context.Context, account string, m Sample) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO bot_voice_samples (account, msg_id, chat, text, sent_at) VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (account, msg_id) DO NOTHING`,
+		account, m.MsgID, m.Chat, m.Text, m.At.UnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("failed to store voice sample: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	s.mu.Lock()
+	for key := range s.cached {
+		if strings.HasPrefix(key, account+"\x00") {
+			delete(s.cached, key)
+		}
+	}
+	s.mu.Unlock()
+	return true, nil
+}
+
+// Prune drops an account's oldest samples beyond MaxSamples
+func (s *Store) Prune(ctx context.Context, account string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM bot_voice_samples WHERE account = $1 AND msg_id NOT IN (
+			SELECT msg_id FROM bot_voice_samples WHERE account = $1 ORDER BY sent_at DESC LIMIT $2
+		)`, account, s.MaxSamples)
+	return err
+}
+
+// Count returns how many samples an account has
+func (s *Store) Count(ctx context.Context, account string) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM bot_voice_samples WHERE account = $1`, account).Scan(&n)
+	return n, err
+}
+
+// Voice profiles the account's owner and picks up to n examples from what
+// they sent to chat. The profile's numbers (length, emoji, casing, scripts)
+// come from all chats, but its phrases and the examples only from chat, so
+// nothing said to someone else ends up in front of the target. ok is false
+// until there are MinSamples samples.
+func (s *Store) Voice(ctx context.Context, account, chat string, n int) (v Voice, ok bool, err error) {
+	key := account + "\x00" + chat
+	s.mu.Lock()
+	v, ok = s.cached[key]
+	s.mu.Unlock()
+	if ok {
+		return v, true, nil
+	}
+
+	samples, err := s.samples(ctx, account)
+	if err != nil || len(samples) < s.MinSamples {
+		return Voice{}, false, err
+	}
+	texts := make([]string, len(samples))
+	var toChat []string
+	for i, m := range samples {
+		texts[i] = m.Text
+		if m.Chat == chat {
+			toChat = append(toChat, m.Text)
+		}
+	}
+	profile := Build(texts)
+	profile.Phrases = Build(toChat).Phrases
+	v = Voice{Profile: profile, Examples: Examples(toChat, n)}
+
+	s.mu.Lock()
+	s.cached[key] = v
+	s.mu.Unlock()
+	return v, true, nil
+}
+
+// samples returns an account's samples, newest first
+func (s *Store) samples(ctx context.Context, account string) ([]Sample, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT msg_id, chat, text, sent_at FROM bot_voice_samples WHERE account = $1 ORDER BY sent_at DESC LIMIT $2`,
+		account, s.MaxSamples)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Sample
+	for rows.Next() {
+		var m Sample
+		var at int64
+		if err := rows.Scan(&m.MsgID, &m.Chat, &m.Text, &at); err != nil {
+			return nil, err
+		}
+		m.At = time.UnixMilli(at)
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
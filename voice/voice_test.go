@@ -0,0 +1,118 @@
+package voice
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"whatsapp-bot/migrate/migratetest"
+)
+
+func TestBuildProfile(t *testing.T) {
+	texts := []string{
+		"haha ok sounds good",
+		"omg haha no way 😂",
+		"wait what",
+		"lol ok",
+		"haha yes!! see u there 😂",
+		"מה קורה",
+		"sure thing",
+		"haha idk...",
+		"Ok.",
+		"on my way 🙏",
+	}
+	p := Build(texts)
+	if p.Samples != 10 || p.Words[1] != 2 || p.Words[3] < 4 {
+		t.Errorf("lengths: %+v", p)
+	}
+	if p.Emoji != 0.3 || len(p.TopEmoji) != 1 || p.TopEmoji[0] != "😂" {
+		t.Errorf("emoji %.2f %v", p.Emoji, p.TopEmoji)
+	}
+	if p.Lowercase < 0.88 || p.Lowercase > 0.89 { // 8 of 9: "Ok." is capitalized, the Hebrew has no case
+		t.Errorf("lowercase %.2f", p.Lowercase)
+	}
+	if p.Period != 0.1 || p.Exclaim != 0.1 || p.Ellipsis != 0.1 {
+		t.Errorf("punctuation %+v", p)
+	}
+	if len(p.Phrases) == 0 || p.Phrases[0] != "haha" {
+		t.Errorf("phrases %v", p.Phrases)
+	}
+	if len(p.Scripts) != 2 || p.Scripts[0].Script != "Latin" || p.Scripts[1].Script != "Hebrew" {
+		t.Errorf("scripts %+v", p.Scripts)
+	}
+	desc := p.Describe()
+	for _, want := range []string{"lowercase", "\"haha\"", "Hebrew", "😂"} {
+		if !strings.Contains(desc, want) {
+			t.Errorf("description lacks %q:\n%s", want, desc)
+		}
+	}
+}
+
+func TestExamplesSkipDetails(t *testing.T) {
+	got := Examples([]string{
+		"call me at 0541234567",
+		"check www.example.com",
+		"ok",
+		"OK",
+		"see you at the beach later",
+	}, 5)
+	if len(got) != 2 || got[0] != "ok" || got[1] != "see you at the beach later" {
+		t.Errorf("examples = %q", got)
+	}
+}
+
+func TestVoiceExamplesComeFromTheChat(t *testing.T) {
+	ctx := context.Background()
+	migratetest.Each(t, Open, func(t *testing.T, s *Store) {
+		s.MinSamples = 4
+
+		at := time.Now()
+		add := func(id, chat, text string) {
+			t.Helper()
+			at = at.Add(time.Minute)
+			if ok, err := s.Add(ctx, "me", Sample{MsgID: id, Chat: chat, Text: text, At: at}); !ok || err != nil {
+				t.Fatalf("add %s: %v %v", id, ok, err)
+			}
+		}
+		for i := range 3 {
+			add(fmt.Sprint("o", i), "other", fmt.Sprint("secret plan number ", i))
+		}
+		if _, ok, _ := s.Voice(ctx, "me", "target", 3); ok {
+			t.Error("profile from too few samples")
+		}
+		add("t1", "target", "hey u")
+		if ok, _ := s.Add(ctx, "me", Sample{MsgID: "t1", Chat: "target", Text: "hey u", At: at}); ok {
+			t.Error("same message stored twice")
+		}
+
+		v, ok, err := s.Voice(ctx, "me", "target", 3)
+		if err != nil || !ok || v.Profile.Samples != 4 {
+			t.Fatalf("voice = %+v, %v, %v", v, ok, err)
+		}
+		if len(v.Examples) != 1 || v.Examples[0] != "hey u" {
+			t.Errorf("examples = %q", v.Examples)
+		}
+		if all := Build([]string{"secret plan number 0", "secret plan number 1", "secret plan number 2", "hey u"}); len(all.Phrases) == 0 {
+			t.Fatal("test samples have no phrases")
+		}
+		if len(v.Profile.Phrases) != 0 {
+			t.Errorf("phrases from another chat: %q", v.Profile.Phrases)
+		}
+
+		// A new sample drops the cached profile
+		add("t2", "target", "lol ok")
+		if v, _, _ := s.Voice(ctx, "me", "target", 3); v.Profile.Samples != 5 || len(v.Examples) != 2 {
+			t.Errorf("stale voice: %+v", v)
+		}
+
+		s.MaxSamples = 2
+		if err := s.Prune(ctx, "me"); err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := s.Count(ctx, "me"); n != 2 {
+			t.Errorf("%d samples after prune, want 2", n)
+		}
+	})
+}